@@ -1,53 +1,205 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/ucups/go-public-api/internal/cache"
 	"github.com/ucups/go-public-api/internal/client"
 	"github.com/ucups/go-public-api/internal/config"
 	"github.com/ucups/go-public-api/internal/handler"
+	"github.com/ucups/go-public-api/internal/idempotency"
+	"github.com/ucups/go-public-api/internal/idempotency/memory"
+	"github.com/ucups/go-public-api/internal/idempotency/sqlite"
+	"github.com/ucups/go-public-api/internal/logging"
+	"github.com/ucups/go-public-api/internal/metrics"
+	"github.com/ucups/go-public-api/internal/model"
+	"github.com/ucups/go-public-api/internal/tracing"
 )
 
 func main() {
+	// Log JSON lines from the start; the level is set once debug is known
+	slog.SetDefault(logging.New(os.Stderr, false))
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("failed to load configuration", "error", err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg.Server.Debug))
+	if len(cfg.Args) > 0 {
+		fatal("unexpected argument", "argument", cfg.Args[0])
+	}
+
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("failed to print configuration", "error", err)
+		}
+		return
+	}
+
+	// Initialize tracing before anything that creates spans
+	shutdownTracing, err := tracing.Setup(context.Background(), "public-api", cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("failed to initialize tracing", "error", err)
 	}
 
-	// Initialize service clients
-	listingClient := client.NewListingClient(cfg.Services.ListingServiceURL)
-	userClient := client.NewUserClient(cfg.Services.UserServiceURL)
+	// Initialize service clients, tracing their calls and reporting them to
+	// the metrics. Each service gets its own circuit breaker.
+	m := metrics.New()
+	clientOpts := client.Options{
+		Timeout:          cfg.Upstream.Timeout,
+		MaxRetries:       cfg.Upstream.MaxRetries,
+		RetryBackoff:     cfg.Upstream.RetryBackoff,
+		RetryMaxBackoff:  cfg.Upstream.RetryMaxBackoff,
+		BreakerThreshold: cfg.Upstream.BreakerThreshold,
+		BreakerCooldown:  cfg.Upstream.BreakerCooldown,
+	}
+	listingClient := client.NewListingClient(cfg.Services.ListingServiceURL, m, clientOpts)
+	userClient := client.NewUserClient(cfg.Services.UserServiceURL, m, clientOpts, newUserCache(cfg.UserCache, m))
+
+	// Initialize idempotency store
+	idempotencyStore, err := openIdempotencyStore(cfg.Idempotency)
+	if err != nil {
+		fatal("failed to open idempotency store", "error", err)
+	}
 
 	// Setup routes
-	mux := handler.SetupRoutes(listingClient, userClient)
+	readiness := handler.NewReadiness()
+	mux := handler.SetupRoutes(listingClient, userClient, readiness, m, handler.Options{
+		EnrichConcurrency: cfg.Enrichment.Concurrency,
+		EnrichPolicy:      handler.EnrichPolicy(cfg.Enrichment.Policy),
+		IdempotencyStore:  idempotencyStore,
+		IdempotencyTTL:    cfg.Idempotency.TTL,
+	})
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	if cfg.Server.Debug {
-		log.Printf("Starting public API in DEBUG mode on %s", addr)
-		log.Printf("Listing Service: %s", cfg.Services.ListingServiceURL)
-		log.Printf("User Service: %s", cfg.Services.UserServiceURL)
-	} else {
-		log.Printf("Starting public API on %s", addr)
+	slog.Info("starting public API", "addr", addr, "debug", cfg.Server.Debug)
+	slog.Debug("configuration",
+		"listing_service", cfg.Services.ListingServiceURL,
+		"user_service", cfg.Services.UserServiceURL,
+		"upstream_timeout", cfg.Upstream.Timeout.String(),
+		"upstream_max_retries", cfg.Upstream.MaxRetries,
+		"user_cache_size", cfg.UserCache.Size,
+		"user_cache_ttl", cfg.UserCache.TTL.String(),
+		"enrich_concurrency", cfg.Enrichment.Concurrency,
+		"enrich_policy", cfg.Enrichment.Policy,
+		"idempotency_store", cfg.Idempotency.Store,
+		"idempotency_ttl", cfg.Idempotency.TTL.String(),
+		"tracing_exporter", cfg.Tracing.Exporter,
+	)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal("failed to listen", "addr", addr, "error", err)
 	}
 
-	// Graceful shutdown
+	// Shut down on SIGINT or SIGTERM; a second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	srv := &http.Server{Handler: mux}
+	serveErr := serve(ctx, srv, ln, readiness, cfg.Server)
+
+	// Handlers cut off by a drain timeout may still be using the store, so
+	// it is left for the process exit to release
+	if errors.Is(serveErr, errDrainTimeout) {
+		slog.Warn("leaving idempotency store open for requests still in flight")
+	} else if err := idempotencyStore.Close(); err != nil {
+		slog.Error("failed to close idempotency store", "error", err)
+	}
+	if err := flushTraces(shutdownTracing); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	if serveErr != nil {
+		fatal("server stopped with an error", "error", serveErr)
+	}
+}
+
+// errDrainTimeout is returned by serve when in-flight requests outlast the
+// drain timeout. Their handlers are not stopped by closing the server and
+// may still be running.
+var errDrainTimeout = errors.New("in-flight requests did not finish before the drain timeout")
+
+// serve runs srv on ln until ctx is done and then shuts it down gracefully.
+// Readiness fails first, and after cfg.ReadinessDelay the listener closes
+// and in-flight requests get up to cfg.DrainTimeout to finish. Connections
+// still open after that are closed and errDrainTimeout is returned.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, readiness *handler.Readiness, cfg config.ServerConfig) error {
+	serverErr := make(chan error, 1)
 	go func() {
-		if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
-		}
+		serverErr <- srv.Serve(ln)
 	}()
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+	readiness.StartDraining()
+	time.Sleep(cfg.ReadinessDelay)
+
+	slog.Info("draining in-flight requests", "timeout", cfg.DrainTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		srv.Close()
+		return errDrainTimeout
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// newUserCache creates the cache of user lookups and exports its usage to
+// m, or returns nil if the cache is disabled
+func newUserCache(cfg config.UserCacheConfig, m *metrics.Metrics) *cache.LRU[int64, model.User] {
+	if cfg.Size == 0 {
+		return nil
+	}
+	userCache := cache.New[int64, model.User](cfg.Size, cfg.TTL)
+	m.RegisterCache("user", userCache.Stats)
+	return userCache
+}
+
+// openIdempotencyStore creates the idempotency store selected by cfg
+func openIdempotencyStore(cfg config.IdempotencyConfig) (idempotency.Store, error) {
+	switch cfg.Store {
+	case "memory":
+		return memory.NewStore(), nil
+	case "sqlite":
+		return sqlite.NewStore(cfg.DBPath)
+	default:
+		return nil, fmt.Errorf("unknown idempotency store %q", cfg.Store)
+	}
+}
+
+// traceFlushTimeout bounds how long shutdown waits for buffered spans to be
+// exported
+const traceFlushTimeout = 5 * time.Second
+
+// flushTraces exports buffered spans and closes the trace exporter
+func flushTraces(shutdown func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancel()
+	return shutdown(ctx)
+}
 
-	log.Println("Shutting down server...")
+// fatal logs msg as an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/config"
+	"github.com/ucups/go-public-api/internal/handler"
+)
+
+// startSlowServer serves a handler that blocks until release is closed and
+// returns the server's address, a channel receiving once a request is in
+// the handler, and a channel receiving serve's result once ctx is done
+func startSlowServer(t *testing.T, ctx context.Context, release <-chan struct{}, cfg config.ServerConfig) (string, <-chan struct{}, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	started := make(chan struct{}, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("done"))
+	})}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(ctx, srv, ln, handler.NewReadiness(), cfg)
+	}()
+	return "http://" + ln.Addr().String(), started, serveErr
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	url, started, serveErr := startSlowServer(t, ctx, release, config.ServerConfig{DrainTimeout: 5 * time.Second})
+
+	type result struct {
+		body string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		done <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	// Shut down while the request is in flight, then let it finish
+	cancel()
+	select {
+	case err := <-serveErr:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("in-flight request failed: %v", res.err)
+	}
+	if res.body != "done" {
+		t.Errorf("body = %q, want %q", res.body, "done")
+	}
+	if err := <-serveErr; err != nil {
+		t.Errorf("serve returned %v, want nil", err)
+	}
+}
+
+func TestServeReportsDrainTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	url, started, serveErr := startSlowServer(t, ctx, release, config.ServerConfig{DrainTimeout: 50 * time.Millisecond})
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	cancel()
+	if err := <-serveErr; !errors.Is(err, errDrainTimeout) {
+		t.Errorf("serve returned %v, want errDrainTimeout", err)
+	}
+}
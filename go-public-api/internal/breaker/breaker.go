@@ -0,0 +1,168 @@
+// Package breaker implements a circuit breaker that stops calls to a failing
+// dependency for a while, so that they fail fast instead of piling up.
+package breaker
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Allow while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a breaker
+type State int
+
+// Breaker states. A closed breaker lets every call through; an open one
+// rejects them all; a half-open one lets a single trial call through to
+// decide whether to close again.
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+// String returns the name of the state, as reported on the health endpoint
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	default:
+		return "half_open"
+	}
+}
+
+// Outcome is the result of a call let through by Allow
+type Outcome int
+
+// Call outcomes. An abandoned call, such as one its caller cancelled, says
+// nothing about the dependency and is neither a success nor a failure.
+const (
+	Success Outcome = iota
+	Failure
+	Abandoned
+)
+
+// Ticket identifies a call let through by Allow. Its outcome only counts
+// towards the breaker state the call was let through in, so that a call
+// still running when the breaker opens cannot close it again, and only the
+// trial call decides the fate of a half-open breaker.
+type Ticket struct {
+	generation uint64
+	trial      bool
+}
+
+// Status is a snapshot of a breaker
+type Status struct {
+	State               State
+	ConsecutiveFailures int
+	OpenedAt            time.Time // When the breaker last opened; zero while closed
+}
+
+// Breaker is a circuit breaker. It opens after a number of consecutive
+// failures and rejects calls for a cooldown period, then lets one trial call
+// through: if it succeeds the breaker closes, otherwise it opens again. A
+// Breaker is safe for concurrent use.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu         sync.Mutex
+	state      State
+	generation uint64 // Incremented on every change of state
+	failures   int
+	openedAt   time.Time
+	probing    bool // A half-open trial call is in flight
+}
+
+// New creates a closed breaker for the dependency name that opens after
+// threshold consecutive failures and stays open for cooldown
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call may go ahead, returning ErrOpen if not. Every
+// call it allows must be followed by exactly one Record with the returned
+// ticket.
+func (b *Breaker) Allow() (Ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return Ticket{generation: b.generation}, nil
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return Ticket{}, ErrOpen
+		}
+		b.setState(HalfOpen)
+		slog.Info("circuit breaker half-open", "dependency", b.name)
+	}
+
+	// Half-open: only one trial call at a time
+	if b.probing {
+		return Ticket{}, ErrOpen
+	}
+	b.probing = true
+	return Ticket{generation: b.generation, trial: true}, nil
+}
+
+// Record reports the outcome of the call Allow issued ticket for. Outcomes
+// of calls let through before the breaker last changed state are ignored.
+func (b *Breaker) Record(ticket Ticket, outcome Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ticket.generation != b.generation {
+		return
+	}
+	if ticket.trial {
+		b.probing = false
+	}
+
+	switch outcome {
+	case Success:
+		if b.state != Closed {
+			slog.Info("circuit breaker closed", "dependency", b.name)
+			b.setState(Closed)
+		}
+		b.failures = 0
+		b.openedAt = time.Time{}
+	case Failure:
+		b.failures++
+		if ticket.trial || b.failures >= b.threshold {
+			b.setState(Open)
+			b.openedAt = time.Now()
+			slog.Warn("circuit breaker opened", "dependency", b.name, "consecutive_failures", b.failures, "cooldown", b.cooldown.String())
+		}
+	}
+}
+
+// setState moves the breaker to state, invalidating the tickets issued so
+// far. The caller must hold b.mu.
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.generation++
+}
+
+// Status returns the current state of the breaker. An open breaker whose
+// cooldown has passed is reported as half-open, as the next call will be
+// let through.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == Open && time.Since(b.openedAt) >= b.cooldown {
+		state = HalfOpen
+	}
+	return Status{State: state, ConsecutiveFailures: b.failures, OpenedAt: b.openedAt}
+}
@@ -0,0 +1,123 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// allow calls b.Allow and fails the test if the call is rejected
+func allow(t *testing.T, b *Breaker) Ticket {
+	t.Helper()
+	ticket, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() = %v, want the call let through", err)
+	}
+	return ticket
+}
+
+// trip opens b with threshold failed calls
+func trip(t *testing.T, b *Breaker, threshold int) {
+	t.Helper()
+	for i := 0; i < threshold; i++ {
+		b.Record(allow(t, b), Failure)
+	}
+}
+
+func assertState(t *testing.T, b *Breaker, want State) {
+	t.Helper()
+	if got := b.Status().State; got != want {
+		t.Fatalf("state = %s, want %s", got, want)
+	}
+}
+
+func TestBreakerOpensAfterThresholdFailures(t *testing.T) {
+	b := New("test", 3, time.Hour)
+
+	trip(t, b, 2)
+	b.Record(allow(t, b), Success)
+	trip(t, b, 2)
+	assertState(t, b, Closed)
+
+	b.Record(allow(t, b), Failure)
+	assertState(t, b, Open)
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() = %v, want ErrOpen", err)
+	}
+}
+
+func TestBreakerLetsOneTrialThroughWhenHalfOpen(t *testing.T) {
+	b := New("test", 1, 0)
+	trip(t, b, 1)
+
+	trial := allow(t, b)
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("second Allow() while half-open = %v, want ErrOpen", err)
+	}
+
+	b.Record(trial, Success)
+	assertState(t, b, Closed)
+	allow(t, b)
+	allow(t, b)
+}
+
+func TestBreakerReopensWhenTrialFails(t *testing.T) {
+	b := New("test", 3, time.Hour)
+	trip(t, b, 3)
+
+	// Let the cooldown pass without waiting for it
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	b.mu.Unlock()
+
+	trial := allow(t, b)
+	b.Record(trial, Failure)
+	assertState(t, b, Open)
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() after a failed trial = %v, want ErrOpen", err)
+	}
+}
+
+func TestBreakerAbandonedTrialAllowsAnother(t *testing.T) {
+	b := New("test", 1, 0)
+	trip(t, b, 1)
+
+	b.Record(allow(t, b), Abandoned)
+	assertState(t, b, HalfOpen)
+	b.Record(allow(t, b), Success)
+	assertState(t, b, Closed)
+}
+
+func TestBreakerIgnoresLateOutcomesWhileHalfOpen(t *testing.T) {
+	for _, outcome := range []Outcome{Success, Failure, Abandoned} {
+		b := New("test", 1, 0)
+
+		// A slow call let through while closed is still running when the
+		// breaker opens and the trial call starts
+		late := allow(t, b)
+		trip(t, b, 1)
+		trial := allow(t, b)
+
+		b.Record(late, outcome)
+		assertState(t, b, HalfOpen)
+		if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+			t.Fatalf("outcome %d of a late call let a second trial through: %v", outcome, err)
+		}
+
+		b.Record(trial, Failure)
+		assertState(t, b, HalfOpen) // Open, reported half-open as the cooldown is zero
+		if b.Status().OpenedAt.IsZero() {
+			t.Errorf("outcome %d of a late call: failed trial did not reopen the breaker", outcome)
+		}
+	}
+}
+
+func TestBreakerIgnoresLateSuccessWhileOpen(t *testing.T) {
+	b := New("test", 1, time.Hour)
+
+	late := allow(t, b)
+	trip(t, b, 1)
+	b.Record(late, Success)
+
+	assertState(t, b, Open)
+}
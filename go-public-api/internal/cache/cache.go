@@ -0,0 +1,127 @@
+// Package cache provides a size-bounded LRU cache whose entries expire.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats counts how a cache has been used since it was created
+type Stats struct {
+	Hits      uint64 // Lookups answered from the cache
+	Misses    uint64 // Lookups of absent or expired keys, or of values the caller could not use
+	Evictions uint64 // Entries dropped to make room for new ones
+	Entries   int    // Entries currently held, including expired ones not yet dropped
+}
+
+// LRU is a cache holding at most a fixed number of entries, each for a fixed
+// time. When full, adding an entry evicts the least recently used one. An
+// LRU is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List // Front is most recently used
+	entries map[K]*list.Element
+	stats   Stats
+}
+
+// entry is a cached value and when it stops being served
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// New creates an LRU holding up to size entries for ttl each
+func New[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU[K, V]{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[K]*list.Element, size),
+	}
+}
+
+// Get returns the value cached for key, if it is present and has not
+// expired, and marks it as recently used
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	return c.GetIf(key, nil)
+}
+
+// GetIf is like Get, but only returns the value if usable reports true for
+// it. A value that is not usable stays cached and the lookup counts as a
+// miss. A nil usable accepts every value.
+func (c *LRU[K, V]) GetIf(key K, usable func(V) bool) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && !time.Now().Before(element.Value.(*entry[K, V]).expires) {
+		c.remove(element)
+		ok = false
+	}
+	if ok {
+		value := element.Value.(*entry[K, V]).value
+		if usable == nil || usable(value) {
+			c.stats.Hits++
+			c.order.MoveToFront(element)
+			return value, true
+		}
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Add caches value for key, replacing any value it had, and evicts the least
+// recently used entry if the cache is over its size
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Remove drops key from the cache
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Stats returns the usage counters of the cache
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// remove drops element from the cache. The caller must hold c.mu.
+func (c *LRU[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry[K, V]).key)
+}
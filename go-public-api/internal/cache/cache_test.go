@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[int, string](2, time.Minute)
+	c.Add(1, "one")
+	c.Add(2, "two")
+	c.Get(1)
+	c.Add(3, "three")
+
+	if _, ok := c.Get(2); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if v, ok := c.Get(1); !ok || v != "one" {
+		t.Errorf("Get(1) = %q, %v, want %q, true", v, ok, "one")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("stats = %+v, want 1 eviction and 2 entries", stats)
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	c := New[int, string](2, 0)
+	c.Add(1, "one")
+
+	if _, ok := c.Get(1); ok {
+		t.Error("expired entry was returned")
+	}
+	if stats := c.Stats(); stats.Misses != 1 || stats.Entries != 0 {
+		t.Errorf("stats = %+v, want 1 miss and no entries", stats)
+	}
+}
+
+func TestLRUGetIfCountsUnusableValueAsMiss(t *testing.T) {
+	c := New[int, string](2, time.Minute)
+	c.Add(1, "one")
+
+	if _, ok := c.GetIf(1, func(v string) bool { return false }); ok {
+		t.Error("unusable value was returned")
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("stats = %+v, want 1 miss and the entry kept", stats)
+	}
+
+	if v, ok := c.GetIf(1, func(v string) bool { return true }); !ok || v != "one" {
+		t.Errorf("GetIf(1) = %q, %v, want %q, true", v, ok, "one")
+	}
+	if stats := c.Stats(); stats.Hits != 1 {
+		t.Errorf("stats = %+v, want 1 hit", stats)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ucups/go-public-api/internal/problem"
+)
+
+// Names of the services the clients talk to, as used in errors
+const (
+	userService    = "user service"
+	listingService = "listing service"
+)
+
+// maxErrorBodyBytes is the most of an error response body that is read
+const maxErrorBodyBytes = 64 << 10
+
+// ServiceError is returned when a service responds with an error status.
+// Problem describes the error as the service reported it: problem details
+// are decoded as they are, and other bodies, such as the listing service's
+// {"result": false, "errors": ...}, are converted to a problem with a code
+// derived from the status.
+type ServiceError struct {
+	Service string
+	Problem *problem.Problem
+}
+
+// Error implements the error interface
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%s returned %d %s: %s", e.Service, e.Problem.Status, e.Problem.Code, e.Problem.Error())
+}
+
+// StatusCode returns the status the service responded with
+func (e *ServiceError) StatusCode() int {
+	return e.Problem.Status
+}
+
+// UnavailableError is returned when a service could not be reached, the
+// request failed or timed out before a response arrived, or the service's
+// circuit breaker is open, in which case Err is breaker.ErrOpen. A request
+// aborted by its context still matches context.Canceled or
+// context.DeadlineExceeded under errors.Is.
+type UnavailableError struct {
+	Service string
+	Err     error
+}
+
+// Error implements the error interface
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s unavailable: %v", e.Service, e.Err)
+}
+
+// Unwrap returns the transport error
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidResponseError is returned when a service responds successfully
+// with a body that cannot be understood
+type InvalidResponseError struct {
+	Service string
+	Err     error
+}
+
+// Error implements the error interface
+func (e *InvalidResponseError) Error() string {
+	return fmt.Sprintf("invalid response from %s: %v", e.Service, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *InvalidResponseError) Unwrap() error {
+	return e.Err
+}
+
+// newServiceError reads the error response resp of service
+func newServiceError(service string, resp *http.Response) *ServiceError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+
+	var p problem.Problem
+	if err := json.Unmarshal(body, &p); err == nil && p.Code != "" {
+		p.Status = resp.StatusCode
+		return &ServiceError{Service: service, Problem: &p}
+	}
+	return &ServiceError{Service: service, Problem: legacyProblem(resp.StatusCode, body)}
+}
+
+// legacyProblem converts an error body that is not a problem to one. The
+// {"result": false, "errors": ...} envelope, where errors is a message or a
+// list of messages, contributes its messages; any other body is used as
+// the detail as it is.
+func legacyProblem(status int, body []byte) *problem.Problem {
+	var envelope struct {
+		Errors json.RawMessage `json:"errors"`
+	}
+	var messages []string
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Errors != nil {
+		var message string
+		if err := json.Unmarshal(envelope.Errors, &message); err == nil {
+			messages = []string{message}
+		} else {
+			json.Unmarshal(envelope.Errors, &messages)
+		}
+	}
+
+	detail := strings.Join(messages, "; ")
+	if detail == "" {
+		detail = strings.TrimSpace(string(body))
+	}
+
+	p := problem.New(status, codeForStatus(status), detail)
+	if p.Code == problem.CodeValidationFailed {
+		for _, message := range messages {
+			p.Errors = append(p.Errors, problem.FieldError{Code: "invalid", Message: message})
+		}
+	}
+	return p
+}
+
+// codeForStatus returns the generic problem code of status, for services
+// that report no code of their own
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return problem.CodeValidationFailed
+	case status == http.StatusNotFound:
+		return problem.CodeNotFound
+	case status == http.StatusMethodNotAllowed:
+		return problem.CodeMethodNotAllowed
+	case status == http.StatusConflict:
+		return problem.CodeConflict
+	case status == http.StatusRequestEntityTooLarge:
+		return problem.CodeBodyTooLarge
+	case status == http.StatusUnsupportedMediaType:
+		return problem.CodeUnsupportedMediaType
+	case status >= http.StatusInternalServerError:
+		return problem.CodeInternal
+	default:
+		return problem.CodeBadRequest
+	}
+}
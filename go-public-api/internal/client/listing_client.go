@@ -1,124 +1,128 @@
 package client
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/ucups/go-public-api/internal/breaker"
+	"github.com/ucups/go-public-api/internal/metrics"
 	"github.com/ucups/go-public-api/internal/model"
 )
 
-// ListingClient handles communication with listing service
+// ListingClient handles communication with listing service. Every call takes
+// a context: cancelling it aborts the request, and the returned error then
+// matches context.Canceled or context.DeadlineExceeded under errors.Is.
+// Errors reported by the listing service are returned as *ServiceError,
+// failed requests as *UnavailableError and undecodable responses as
+// *InvalidResponseError. The listing service answers with its fields next
+// to "result", without a data envelope.
 type ListingClient struct {
 	baseURL    string
 	httpClient *http.Client
+	breaker    *breaker.Breaker
 }
 
-// NewListingClient creates a new listing service client
-func NewListingClient(baseURL string) *ListingClient {
+// NewListingClient creates a new listing service client. Calls time out, are
+// retried and go through a circuit breaker as opts configures. They are
+// reported to m under the client name "listing".
+func NewListingClient(baseURL string, m *metrics.Metrics, opts Options) *ListingClient {
+	b := breaker.New(listingService, opts.BreakerThreshold, opts.BreakerCooldown)
 	return &ListingClient{
 		baseURL:    baseURL,
-		httpClient: &http.Client{},
+		httpClient: newHTTPClient("listing", m, opts, b),
+		breaker:    b,
 	}
 }
 
-// GetListings retrieves listings with optional user_id filter
-func (c *ListingClient) GetListings(pageNum, pageSize int, userID *int64) ([]model.Listing, error) {
+// Breaker returns the status of the listing service's circuit breaker
+func (c *ListingClient) Breaker() breaker.Status {
+	return c.breaker.Status()
+}
+
+// ListingQuery selects a page of listings
+type ListingQuery struct {
+	PageNum  int
+	PageSize int
+	// Cursor continues after a previous page and takes precedence over
+	// PageNum. It is opaque and passed to the listing service verbatim.
+	Cursor       string
+	UserID       *int64 // Only listings of this user when set
+	IncludeTotal bool   // Have the listing service count matching listings
+}
+
+// GetListings retrieves a page of listings, newest first
+func (c *ListingClient) GetListings(ctx context.Context, query ListingQuery) (*model.ListingPage, error) {
 	params := url.Values{}
-	params.Add("page_num", strconv.Itoa(pageNum))
-	params.Add("page_size", strconv.Itoa(pageSize))
-	if userID != nil {
-		params.Add("user_id", strconv.FormatInt(*userID, 10))
+	params.Add("page_num", strconv.Itoa(query.PageNum))
+	params.Add("page_size", strconv.Itoa(query.PageSize))
+	params.Add("include_total", strconv.FormatBool(query.IncludeTotal))
+	if query.Cursor != "" {
+		params.Add("cursor", query.Cursor)
+	}
+	if query.UserID != nil {
+		params.Add("user_id", strconv.FormatInt(*query.UserID, 10))
 	}
 
 	apiURL := fmt.Sprintf("%s/listings?%s", c.baseURL, params.Encode())
-	resp, err := c.httpClient.Get(apiURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get listings: %w", err)
+		return nil, fmt.Errorf("failed to build request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("listing service returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var serviceResp model.ServiceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&serviceResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	resp, err := send(c.httpClient, listingService, req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if !serviceResp.Result {
-		return nil, fmt.Errorf("listing service error: %v", serviceResp.Errors)
+	var page model.ListingPage
+	if err := decodeResult(listingService, resp.Body, &page); err != nil {
+		return nil, err
 	}
-
-	// Extract listings from data
-	listingsData, ok := serviceResp.Data["listings"]
-	if !ok {
-		return []model.Listing{}, nil
+	if page.Listings == nil {
+		page.Listings = []model.Listing{}
 	}
-
-	// Convert to JSON and back to proper type
-	jsonData, err := json.Marshal(listingsData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal listings: %w", err)
+	if page.NextCursor != "" {
+		page.HasMore = true
 	}
 
-	var listings []model.Listing
-	if err := json.Unmarshal(jsonData, &listings); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal listings: %w", err)
-	}
-
-	return listings, nil
+	return &page, nil
 }
 
 // CreateListing creates a new listing
-func (c *ListingClient) CreateListing(userID int64, listingType string, price int64) (*model.Listing, error) {
+func (c *ListingClient) CreateListing(ctx context.Context, userID int64, listingType string, price int64) (*model.Listing, error) {
 	data := url.Values{}
 	data.Set("user_id", strconv.FormatInt(userID, 10))
 	data.Set("listing_type", listingType)
 	data.Set("price", strconv.FormatInt(price, 10))
 
 	apiURL := fmt.Sprintf("%s/listings", c.baseURL)
-	resp, err := c.httpClient.PostForm(apiURL, data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(data.Encode()))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create listing: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("listing service returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var serviceResp model.ServiceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&serviceResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to build request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	if !serviceResp.Result {
-		return nil, fmt.Errorf("listing service error: %v", serviceResp.Errors)
+	resp, err := send(c.httpClient, listingService, req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Extract listing from data
-	listingData, ok := serviceResp.Data["listing"]
-	if !ok {
-		return nil, fmt.Errorf("no listing in response")
+	var created struct {
+		Listing *model.Listing `json:"listing"`
 	}
-
-	// Convert to JSON and back to proper type
-	jsonData, err := json.Marshal(listingData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal listing: %w", err)
+	if err := decodeResult(listingService, resp.Body, &created); err != nil {
+		return nil, err
 	}
-
-	var listing model.Listing
-	if err := json.Unmarshal(jsonData, &listing); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal listing: %w", err)
+	if created.Listing == nil {
+		return nil, &InvalidResponseError{Service: listingService, Err: errors.New("no listing in response")}
 	}
 
-	return &listing, nil
+	return created.Listing, nil
 }
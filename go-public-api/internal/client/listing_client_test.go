@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ucups/go-public-api/internal/metrics"
+)
+
+// Bodies as listing_service.py writes them: fields sit next to "result"
+const (
+	listingsPageBody = `{"result": true, "listings": [` +
+		`{"id": 2, "user_id": 1, "listing_type": "rent", "price": 6000, "created_at": 1475820997000001, "updated_at": 1475820997000001}, ` +
+		`{"id": 1, "user_id": 2, "listing_type": "sale", "price": 450000, "created_at": 1475820997000000, "updated_at": 1475820997000000}], ` +
+		`"next_cursor": "MTQ3NTgyMDk5NzAwMDAwMDox", "has_more": true, "total": 5}`
+	createdListingBody = `{"result": true, "listing": {"id": 7, "user_id": 1, "listing_type": "rent", "price": 5500, "created_at": 1475820997000000, "updated_at": 1475820997000000}}`
+)
+
+// newTestListingClient returns a client for a fake listing service that
+// answers every request with handler
+func newTestListingClient(t *testing.T, handler http.HandlerFunc) *ListingClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewListingClient(srv.URL, metrics.New(), Options{BreakerThreshold: 5})
+}
+
+func TestListingClientGetListingsDecodesListingServiceBody(t *testing.T) {
+	c := newTestListingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(listingsPageBody))
+	})
+
+	page, err := c.GetListings(context.Background(), ListingQuery{PageNum: 1, PageSize: 2, IncludeTotal: true})
+	if err != nil {
+		t.Fatalf("GetListings: %v", err)
+	}
+	if len(page.Listings) != 2 || page.Listings[0].ID != 2 || page.Listings[1].UserID != 2 {
+		t.Errorf("listings = %+v, want listings 2 and 1", page.Listings)
+	}
+	if page.Listings[1].ListingType != "sale" || page.Listings[1].Price != 450000 {
+		t.Errorf("second listing = %+v, want a sale at 450000", page.Listings[1])
+	}
+}
+
+func TestListingClientCreateListingDecodesListingServiceBody(t *testing.T) {
+	c := newTestListingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		if got := r.PostForm.Get("listing_type"); got != "rent" {
+			t.Errorf("listing_type = %q, want rent", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(createdListingBody))
+	})
+
+	listing, err := c.CreateListing(context.Background(), 1, "rent", 5500)
+	if err != nil {
+		t.Fatalf("CreateListing: %v", err)
+	}
+	if listing.ID != 7 || listing.UserID != 1 || listing.Price != 5500 {
+		t.Errorf("listing = %+v, want listing 7 of user 1 at 5500", listing)
+	}
+}
+
+func TestListingClientRejectsFailedResult(t *testing.T) {
+	c := newTestListingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result": false}`))
+	})
+
+	_, err := c.GetListings(context.Background(), ListingQuery{PageNum: 1, PageSize: 10})
+	var invalidErr *InvalidResponseError
+	if !errors.As(err, &invalidErr) {
+		t.Fatalf("err = %v, want *InvalidResponseError", err)
+	}
+}
+
+func TestListingClientConvertsLegacyErrors(t *testing.T) {
+	c := newTestListingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"result": false, "errors": ["invalid user_id", "price must be greater than 0"]}`))
+	})
+
+	_, err := c.CreateListing(context.Background(), 1, "rent", 0)
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("err = %v, want *ServiceError", err)
+	}
+	if serviceErr.StatusCode() != http.StatusBadRequest || serviceErr.Problem.Code != "validation_failed" {
+		t.Errorf("problem = %d %s, want 400 validation_failed", serviceErr.StatusCode(), serviceErr.Problem.Code)
+	}
+	if len(serviceErr.Problem.Errors) != 2 {
+		t.Errorf("field errors = %+v, want one per message", serviceErr.Problem.Errors)
+	}
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/breaker"
+)
+
+// Options configures how a client copes with a slow or failing service
+type Options struct {
+	// Timeout limits each attempt of a call, from sending the request to
+	// closing the response body. Zero means no limit.
+	Timeout time.Duration
+	// MaxRetries is how many times a failed GET is retried. Other methods
+	// are never retried, since a failed attempt may still have taken effect.
+	MaxRetries int
+	// RetryBackoff is the longest wait before the first retry. It doubles
+	// for each later retry, up to RetryMaxBackoff. Every wait is a random
+	// duration up to that limit, so that clients retrying at the same time
+	// spread out.
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	// BreakerThreshold consecutive failures open the service's circuit
+	// breaker, which then fails calls immediately for BreakerCooldown before
+	// letting a trial call through
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// retryTransport gives each attempt of a request its own timeout and
+// retries GETs that fail with a transport error, a timeout or a 502, 503 or
+// 504 response, waiting a jittered exponential backoff between attempts
+type retryTransport struct {
+	base http.RoundTripper
+	opts Options
+}
+
+// RoundTrip sends the request, retrying it as the options allow. When every
+// attempt fails, the last error or response is returned.
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if req.Method == http.MethodGet {
+		attempts += t.opts.MaxRetries
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.attempt(req)
+		if attempt == attempts || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(t.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// attempt sends the request once, within the attempt timeout. The timeout
+// stays in force until the response body is closed. The attempt's context
+// keeps the caller's, so that breakerTransport can tell the attempt timing
+// out from the caller giving up.
+func (t retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.opts.Timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := context.WithValue(req.Context(), callerContextKey{}, req.Context())
+	ctx, cancel := context.WithTimeout(ctx, t.opts.Timeout)
+	resp, err := t.base.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns how long to wait after the given failed attempt: a random
+// duration up to RetryBackoff doubled for every attempt before it, capped at
+// RetryMaxBackoff
+func (t retryTransport) backoff(attempt int) time.Duration {
+	limit := t.opts.RetryBackoff
+	for i := 1; i < attempt && limit < t.opts.RetryMaxBackoff; i++ {
+		limit *= 2
+	}
+	if t.opts.RetryMaxBackoff > 0 && limit > t.opts.RetryMaxBackoff {
+		limit = t.opts.RetryMaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// retryable reports whether an attempt that returned resp or err is worth
+// repeating. Nothing is retried once the caller has given up, nor while the
+// circuit breaker is open.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, breaker.ErrOpen)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// callerContextKey is the context key of the context of the call an
+// attempt belongs to
+type callerContextKey struct{}
+
+// callerContext returns the context of the call req is an attempt of. It is
+// req's own context unless the attempt has a timeout of its own.
+func callerContext(req *http.Request) context.Context {
+	if ctx, ok := req.Context().Value(callerContextKey{}).(context.Context); ok {
+		return ctx
+	}
+	return req.Context()
+}
+
+// cancelOnClose releases an attempt's timeout once its response body is
+// closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the timeout
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// breakerTransport sends requests through a circuit breaker. Transport
+// errors, attempt timeouts and 5xx responses count as failures; a request
+// its caller cancelled or ran out of time for counts as neither failure nor
+// success, since it says nothing about the service's health.
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *breaker.Breaker
+}
+
+// RoundTrip sends the request unless the breaker is open, in which case
+// breaker.ErrOpen is returned without contacting the service
+func (t breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ticket, err := t.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && callerContext(req).Err() != nil:
+		t.breaker.Record(ticket, breaker.Abandoned)
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		t.breaker.Record(ticket, breaker.Failure)
+	default:
+		t.breaker.Record(ticket, breaker.Success)
+	}
+	return resp, err
+}
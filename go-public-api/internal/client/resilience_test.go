@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/breaker"
+	"github.com/ucups/go-public-api/internal/metrics"
+)
+
+// fakeUpstream is a service that answers its nth request, counting from 1,
+// with respond(n)
+type fakeUpstream struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newFakeUpstream(t *testing.T, respond func(n int, w http.ResponseWriter, r *http.Request)) *fakeUpstream {
+	t.Helper()
+	u := &fakeUpstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(int(u.requests.Add(1)), w, r)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// newTestHTTPClient returns the resilient HTTP client with its breaker
+func newTestHTTPClient(opts Options) (*http.Client, *breaker.Breaker) {
+	b := breaker.New("test", opts.BreakerThreshold, opts.BreakerCooldown)
+	return newHTTPClient("test", metrics.New(), opts, b), b
+}
+
+// statusAfter answers with status until the nth request and 200 from then on
+func statusAfter(status, n int) func(int, http.ResponseWriter, *http.Request) {
+	return func(i int, w http.ResponseWriter, r *http.Request) {
+		if i < n {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+func TestRetryTransportRetriesUnavailableGet(t *testing.T) {
+	upstream := newFakeUpstream(t, statusAfter(http.StatusServiceUnavailable, 3))
+	httpClient, _ := newTestHTTPClient(Options{MaxRetries: 2, BreakerThreshold: 10})
+
+	resp, err := httpClient.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := upstream.requests.Load(); got != 3 {
+		t.Errorf("upstream got %d requests, want 3", got)
+	}
+}
+
+func TestRetryTransportReturnsLastResponseWhenRetriesRunOut(t *testing.T) {
+	upstream := newFakeUpstream(t, statusAfter(http.StatusBadGateway, 100))
+	httpClient, _ := newTestHTTPClient(Options{MaxRetries: 2, BreakerThreshold: 10})
+
+	resp, err := httpClient.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if got := upstream.requests.Load(); got != 3 {
+		t.Errorf("upstream got %d requests, want 3", got)
+	}
+}
+
+func TestRetryTransportDoesNotRetryPost(t *testing.T) {
+	upstream := newFakeUpstream(t, statusAfter(http.StatusServiceUnavailable, 100))
+	httpClient, _ := newTestHTTPClient(Options{MaxRetries: 2, BreakerThreshold: 10})
+
+	resp, err := httpClient.Post(upstream.URL, "application/x-www-form-urlencoded", strings.NewReader("name=Ada"))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+	if got := upstream.requests.Load(); got != 1 {
+		t.Errorf("upstream got %d requests, want 1", got)
+	}
+}
+
+func TestRetryTransportTimesOutEachAttempt(t *testing.T) {
+	upstream := newFakeUpstream(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 1 {
+			// Hang until the client gives up on the attempt
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	httpClient, _ := newTestHTTPClient(Options{Timeout: 50 * time.Millisecond, MaxRetries: 1, BreakerThreshold: 10})
+
+	start := time.Now()
+	resp, err := httpClient.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("call took %v, want the hung attempt cut off", elapsed)
+	}
+}
+
+func TestBreakerTransportFailsFastWhenOpen(t *testing.T) {
+	upstream := newFakeUpstream(t, statusAfter(http.StatusInternalServerError, 100))
+	httpClient, b := newTestHTTPClient(Options{BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Get(upstream.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	if state := b.Status().State; state != breaker.Open {
+		t.Fatalf("breaker is %s, want open", state)
+	}
+
+	if _, err := httpClient.Get(upstream.URL); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Get() error = %v, want breaker.ErrOpen", err)
+	}
+	if got := upstream.requests.Load(); got != 2 {
+		t.Errorf("upstream got %d requests, want 2", got)
+	}
+}
+
+func TestRetryTransportStopsRetryingWhenBreakerOpens(t *testing.T) {
+	upstream := newFakeUpstream(t, statusAfter(http.StatusServiceUnavailable, 100))
+	httpClient, _ := newTestHTTPClient(Options{MaxRetries: 5, BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	if _, err := httpClient.Get(upstream.URL); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Get() error = %v, want breaker.ErrOpen", err)
+	}
+	if got := upstream.requests.Load(); got != 2 {
+		t.Errorf("upstream got %d requests, want 2", got)
+	}
+}
+
+func TestBreakerTransportClosesAfterSuccessfulTrial(t *testing.T) {
+	upstream := newFakeUpstream(t, statusAfter(http.StatusInternalServerError, 2))
+	httpClient, b := newTestHTTPClient(Options{BreakerThreshold: 1})
+
+	resp, err := httpClient.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	// With no cooldown the next call is the half-open trial
+	resp, err = httpClient.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("trial Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if state := b.Status().State; state != breaker.Closed {
+		t.Errorf("breaker is %s after a successful trial, want closed", state)
+	}
+}
+
+func TestBreakerTransportIgnoresCallerDeadline(t *testing.T) {
+	upstream := newFakeUpstream(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		// Hang until the client gives up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	// The caller's deadline runs out before the attempt's timeout, which is
+	// no fault of the service
+	httpClient, b := newTestHTTPClient(Options{Timeout: time.Second, BreakerThreshold: 1, BreakerCooldown: time.Hour})
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		_, err := httpClient.Do(req)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Do() error = %v, want context.DeadlineExceeded", err)
+		}
+	}
+	if status := b.Status(); status.State != breaker.Closed || status.ConsecutiveFailures != 0 {
+		t.Errorf("breaker = %+v, want closed with no failures", status)
+	}
+
+	// The attempt's own timeout is
+	httpClient, b = newTestHTTPClient(Options{Timeout: 20 * time.Millisecond, BreakerThreshold: 1, BreakerCooldown: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	if _, err := httpClient.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Do() error = %v, want context.DeadlineExceeded", err)
+	}
+	if state := b.Status().State; state != breaker.Open {
+		t.Errorf("breaker is %s, want open", state)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// send sends req to service and checks the response status. A request that
+// fails before a response arrives is returned as *UnavailableError and a
+// response other than 200 as *ServiceError. On success the caller must
+// close the response body.
+func send(httpClient *http.Client, service string, req *http.Request) (*http.Response, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &UnavailableError{Service: service, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newServiceError(service, resp)
+	}
+	return resp, nil
+}
+
+// decodeData decodes the data of a {"result": true, "data": ...} response
+// from service into dst. A body that does not decode is returned as
+// *InvalidResponseError.
+func decodeData(service string, body io.Reader, dst interface{}) error {
+	var serviceResp struct {
+		Result bool            `json:"result"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&serviceResp); err != nil {
+		return &InvalidResponseError{Service: service, Err: err}
+	}
+	if !serviceResp.Result || serviceResp.Data == nil {
+		return &InvalidResponseError{Service: service, Err: errors.New("response has no data")}
+	}
+	if err := json.Unmarshal(serviceResp.Data, dst); err != nil {
+		return &InvalidResponseError{Service: service, Err: err}
+	}
+	return nil
+}
+
+// decodeResult decodes a {"result": true, ...} response from service, whose
+// fields sit next to result rather than in a data envelope, into dst. A body
+// that does not decode is returned as *InvalidResponseError.
+func decodeResult(service string, body io.Reader, dst interface{}) error {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return &InvalidResponseError{Service: service, Err: err}
+	}
+
+	var serviceResp struct {
+		Result bool `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &serviceResp); err != nil {
+		return &InvalidResponseError{Service: service, Err: err}
+	}
+	if !serviceResp.Result {
+		return &InvalidResponseError{Service: service, Err: errors.New("response is not a result")}
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return &InvalidResponseError{Service: service, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/breaker"
+	"github.com/ucups/go-public-api/internal/logging"
+	"github.com/ucups/go-public-api/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates a client span for every outbound request
+var tracer = otel.Tracer("github.com/ucups/go-public-api/internal/client")
+
+// newHTTPClient creates the HTTP client a service client named name uses.
+// It forwards the request ID of the incoming request, so that upstream log
+// lines can be tied to it, times out and retries attempts as opts allow and
+// sends them through b, traces every attempt and propagates the trace in the
+// traceparent header, and reports every attempt to m.
+func newHTTPClient(name string, m *metrics.Metrics, opts Options, b *breaker.Breaker) *http.Client {
+	return &http.Client{
+		Transport: requestIDTransport{
+			base: retryTransport{
+				base: breakerTransport{
+					base: tracingTransport{
+						base:   metricsTransport{base: http.DefaultTransport, client: name, metrics: m},
+						client: name,
+					},
+					breaker: b,
+				},
+				opts: opts,
+			},
+		},
+	}
+}
+
+// requestIDTransport sets the X-Request-ID header of outbound requests from
+// the request ID carried by their context
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip adds the request ID header, if any, and sends the request
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if requestID := logging.RequestID(req.Context()); requestID != "" && req.Header.Get(logging.RequestIDHeader) == "" {
+		// A RoundTripper must not modify the request it was given
+		req = req.Clone(req.Context())
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// tracingTransport starts a client span for each outbound request and
+// injects its trace context into the request headers
+type tracingTransport struct {
+	base   http.RoundTripper
+	client string
+}
+
+// RoundTrip sends the request within its span. Transport errors and 5xx
+// responses mark the span as failed.
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), req.Method+" "+t.client+" service",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("peer.service", t.client),
+		),
+	)
+	defer span.End()
+
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// metricsTransport records the outcome of outbound requests and their
+// latency up to the arrival of the response headers
+type metricsTransport struct {
+	base    http.RoundTripper
+	client  string
+	metrics *metrics.Metrics
+}
+
+// RoundTrip sends the request and reports it. Transport errors and 5xx
+// responses count as errors, except when the caller cancelled the request.
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	status := 0
+	failed := err != nil && !errors.Is(req.Context().Err(), context.Canceled)
+	if resp != nil {
+		status = resp.StatusCode
+		failed = failed || resp.StatusCode >= http.StatusInternalServerError
+	}
+	t.metrics.ObserveUpstream(t.client, req.Method, status, time.Since(start), failed)
+	return resp, err
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ucups/go-public-api/internal/model"
+)
+
+// GetUser retrieves a user by ID. With a cache, a cached user is returned
+// without calling the user service, and concurrent misses for the same ID
+// share one call. Deleted users are never served from the cache, so that
+// they are reported missing as the user service reports them.
+func (c *UserClient) GetUser(ctx context.Context, userID int64) (*model.User, error) {
+	if c.cache == nil {
+		return c.fetchUser(ctx, userID)
+	}
+	if user, ok := c.cache.GetIf(userID, notDeleted); ok {
+		return &user, nil
+	}
+
+	generation := c.cacheGeneration()
+	key := "user:" + strconv.FormatInt(userID, 10) + ":" + strconv.FormatUint(generation, 10)
+	result, err := c.share(ctx, key, func(ctx context.Context) (interface{}, error) {
+		user, err := c.fetchUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		c.cacheUsers(generation, *user)
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	user := *result.(*model.User)
+	return &user, nil
+}
+
+// GetUsers retrieves the users matching userIDs. It returns the users that
+// were found and the IDs the user service could not find. Deleted users are
+// only returned when includeDeleted is set. At most MaxUsersPerBatch IDs can
+// be requested at once. With a cache, cached users are served from it and
+// the rest are fetched in a single call, which concurrent lookups of the
+// same IDs share.
+func (c *UserClient) GetUsers(ctx context.Context, userIDs []int64, includeDeleted bool) ([]model.User, []int64, error) {
+	if c.cache == nil {
+		return c.fetchUsers(ctx, userIDs, includeDeleted)
+	}
+
+	usable := notDeleted
+	if includeDeleted {
+		usable = nil
+	}
+	users := make([]model.User, 0, len(userIDs))
+	var misses []int64
+	for _, id := range userIDs {
+		if user, ok := c.cache.GetIf(id, usable); ok {
+			users = append(users, user)
+			continue
+		}
+		misses = append(misses, id)
+	}
+	if len(misses) == 0 {
+		return users, []int64{}, nil
+	}
+
+	type fetched struct {
+		users   []model.User
+		missing []int64
+	}
+	generation := c.cacheGeneration()
+	key := batchKey(misses, includeDeleted) + ":" + strconv.FormatUint(generation, 10)
+	result, err := c.share(ctx, key, func(ctx context.Context) (interface{}, error) {
+		found, missing, err := c.fetchUsers(ctx, misses, includeDeleted)
+		if err != nil {
+			return nil, err
+		}
+		c.cacheUsers(generation, found...)
+		return fetched{found, missing}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batch := result.(fetched)
+	return append(users, batch.users...), batch.missing, nil
+}
+
+// InvalidateUser drops a user from the cache, so that the next lookup
+// fetches it from the user service. Fetches already in flight neither
+// cache their result nor share it with later lookups, as it may predate the
+// change that made the user stale.
+func (c *UserClient) InvalidateUser(userID int64) {
+	if c.cache == nil {
+		return
+	}
+	c.generationMu.Lock()
+	defer c.generationMu.Unlock()
+	c.generation++
+	c.cache.Remove(userID)
+}
+
+// cacheGeneration returns the number of invalidations so far
+func (c *UserClient) cacheGeneration() uint64 {
+	c.generationMu.Lock()
+	defer c.generationMu.Unlock()
+	return c.generation
+}
+
+// cacheUsers caches users fetched in generation, unless a user has been
+// invalidated since
+func (c *UserClient) cacheUsers(generation uint64, users ...model.User) {
+	c.generationMu.Lock()
+	defer c.generationMu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	for _, user := range users {
+		c.cache.Add(user.ID, user)
+	}
+}
+
+// notDeleted reports whether a cached user can be served to lookups that
+// exclude deleted users
+func notDeleted(user model.User) bool {
+	return user.DeletedAt == nil
+}
+
+// share runs fetch for key, or waits for the run already in flight for it,
+// and returns its result. The shared run does not stop when ctx is
+// cancelled, as other callers may still want its result; a cancelled caller
+// stops waiting for it instead.
+func (c *UserClient) share(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	results := c.flights.DoChan(key, func() (interface{}, error) {
+		return fetch(context.WithoutCancel(ctx))
+	})
+	select {
+	case result := <-results:
+		return result.Val, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// batchKey identifies a batch lookup regardless of the order of its IDs
+func batchKey(userIDs []int64, includeDeleted bool) string {
+	sorted := append([]int64(nil), userIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ids := make([]string, len(sorted))
+	for i, id := range sorted {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	return "users:" + strings.Join(ids, ",") + ":" + strconv.FormatBool(includeDeleted)
+}
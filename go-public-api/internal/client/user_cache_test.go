@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/cache"
+	"github.com/ucups/go-public-api/internal/metrics"
+	"github.com/ucups/go-public-api/internal/model"
+)
+
+// newTestCachedUserClient returns a user client with a cache, talking to a
+// fake user service served by handler
+func newTestCachedUserClient(t *testing.T, handler http.HandlerFunc) (*UserClient, *cache.LRU[int64, model.User]) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	userCache := cache.New[int64, model.User](10, time.Minute)
+	return NewUserClient(srv.URL, metrics.New(), Options{BreakerThreshold: 5}, userCache), userCache
+}
+
+func TestGetUsersDoesNotCountDeletedUserAsHit(t *testing.T) {
+	var requests atomic.Int32
+	c, userCache := newTestCachedUserClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Query().Get("include_deleted") == "true" {
+			fmt.Fprint(w, `{"result": true, "data": {"users": [{"id": 1, "name": "Ada", "deleted_at": 1700000000}], "missing_ids": []}}`)
+			return
+		}
+		fmt.Fprint(w, `{"result": true, "data": {"users": [], "missing_ids": [1]}}`)
+	})
+	ctx := context.Background()
+
+	if _, _, err := c.GetUsers(ctx, []int64{1}, true); err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	users, missing, err := c.GetUsers(ctx, []int64{1}, false)
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 0 || len(missing) != 1 {
+		t.Errorf("GetUsers() = %v, missing %v, want the deleted user missing", users, missing)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("user service got %d requests, want 2", got)
+	}
+	if stats := userCache.Stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("cache stats = %+v, want no hits and 2 misses", stats)
+	}
+
+	// The deleted user is still served to lookups that include it
+	if _, _, err := c.GetUsers(ctx, []int64{1}, true); err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if stats := userCache.Stats(); stats.Hits != 1 {
+		t.Errorf("cache stats = %+v, want 1 hit", stats)
+	}
+}
+
+func TestGetUserIgnoresFetchStartedBeforeInvalidation(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c, _ := newTestCachedUserClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// The first fetch reads the user before it is updated and is
+			// slow to answer
+			close(started)
+			<-release
+			fmt.Fprint(w, `{"result": true, "data": {"user": {"id": 1, "name": "Old"}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"result": true, "data": {"user": {"id": 1, "name": "New"}}}`)
+	})
+	ctx := context.Background()
+
+	type result struct {
+		user *model.User
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		user, err := c.GetUser(ctx, 1)
+		slow <- result{user, err}
+	}()
+	<-started
+
+	c.InvalidateUser(1)
+
+	// A lookup after the invalidation does not wait for the stale fetch
+	user, err := c.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user.Name != "New" {
+		t.Errorf("GetUser() after invalidation = %q, want %q", user.Name, "New")
+	}
+
+	close(release)
+	if res := <-slow; res.err != nil {
+		t.Fatalf("slow GetUser() error = %v", res.err)
+	}
+
+	// The stale fetch finished last but did not overwrite the cache
+	user, err = c.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user.Name != "New" {
+		t.Errorf("cached user = %q, want %q", user.Name, "New")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("user service got %d requests, want 2", got)
+	}
+}
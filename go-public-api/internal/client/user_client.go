@@ -1,114 +1,287 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/ucups/go-public-api/internal/breaker"
+	"github.com/ucups/go-public-api/internal/cache"
+	"github.com/ucups/go-public-api/internal/metrics"
 	"github.com/ucups/go-public-api/internal/model"
+	"golang.org/x/sync/singleflight"
 )
 
-// UserClient handles communication with user service
+// UserClient handles communication with user service. Every call takes a
+// context: cancelling it aborts the request, and the returned error then
+// matches context.Canceled or context.DeadlineExceeded under errors.Is.
+// Errors reported by the user service are returned as *ServiceError carrying
+// its problem details, failed requests as *UnavailableError and
+// undecodable responses as *InvalidResponseError.
 type UserClient struct {
 	baseURL    string
 	httpClient *http.Client
+	breaker    *breaker.Breaker
+	cache      *cache.LRU[int64, model.User]
+	flights    singleflight.Group
+
+	// generation counts invalidations. Fetches only cache their users if no
+	// invalidation happened while they ran, and only share their result with
+	// lookups from the same generation.
+	generationMu sync.Mutex
+	generation   uint64
 }
 
-// NewUserClient creates a new user service client
-func NewUserClient(baseURL string) *UserClient {
+// NewUserClient creates a new user service client. Calls time out, are
+// retried and go through a circuit breaker as opts configures. They are
+// reported to m under the client name "user". Users are cached in
+// userCache, which may be nil to disable caching.
+func NewUserClient(baseURL string, m *metrics.Metrics, opts Options, userCache *cache.LRU[int64, model.User]) *UserClient {
+	b := breaker.New(userService, opts.BreakerThreshold, opts.BreakerCooldown)
 	return &UserClient{
 		baseURL:    baseURL,
-		httpClient: &http.Client{},
+		httpClient: newHTTPClient("user", m, opts, b),
+		breaker:    b,
+		cache:      userCache,
 	}
 }
 
-// GetUser retrieves a user by ID
-func (c *UserClient) GetUser(userID int64) (*model.User, error) {
+// Breaker returns the status of the user service's circuit breaker
+func (c *UserClient) Breaker() breaker.Status {
+	return c.breaker.Status()
+}
+
+// fetchUser retrieves a user by ID from the user service
+func (c *UserClient) fetchUser(ctx context.Context, userID int64) (*model.User, error) {
 	apiURL := fmt.Sprintf("%s/users/%d", c.baseURL, userID)
-	resp, err := c.httpClient.Get(apiURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := send(c.httpClient, userService, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("user service returned status %d: %s", resp.StatusCode, string(body))
+	var data struct {
+		User *model.User `json:"user"`
+	}
+	if err := decodeData(userService, resp.Body, &data); err != nil {
+		return nil, err
+	}
+	if data.User == nil {
+		return nil, &InvalidResponseError{Service: userService, Err: errors.New("no user in response")}
 	}
 
-	var serviceResp model.ServiceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&serviceResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	return data.User, nil
+}
+
+// MaxUsersPerBatch is the maximum number of IDs the user service accepts in
+// a single batch lookup
+const MaxUsersPerBatch = 100
+
+// fetchUsers retrieves the users matching userIDs from the user service in a
+// single call
+func (c *UserClient) fetchUsers(ctx context.Context, userIDs []int64, includeDeleted bool) ([]model.User, []int64, error) {
+	if len(userIDs) == 0 {
+		return []model.User{}, []int64{}, nil
 	}
 
-	if !serviceResp.Result {
-		return nil, fmt.Errorf("user service error: %v", serviceResp.Errors)
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = strconv.FormatInt(id, 10)
 	}
 
-	// Extract user from data
-	userData, ok := serviceResp.Data["user"]
-	if !ok {
-		return nil, fmt.Errorf("no user in response")
+	params := url.Values{}
+	params.Add("ids", strings.Join(ids, ","))
+	if includeDeleted {
+		params.Add("include_deleted", "true")
 	}
 
-	// Convert to JSON and back to proper type
-	jsonData, err := json.Marshal(userData)
+	apiURL := fmt.Sprintf("%s/users?%s", c.baseURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal user: %w", err)
+		return nil, nil, fmt.Errorf("failed to build request: %w", err)
 	}
 
-	var user model.User
-	if err := json.Unmarshal(jsonData, &user); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	resp, err := send(c.httpClient, userService, req)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
-	return &user, nil
+	var data struct {
+		Users      []model.User `json:"users"`
+		MissingIDs []int64      `json:"missing_ids"`
+	}
+	if err := decodeData(userService, resp.Body, &data); err != nil {
+		return nil, nil, err
+	}
+
+	return data.Users, data.MissingIDs, nil
 }
 
-// CreateUser creates a new user
-func (c *UserClient) CreateUser(name string) (*model.User, error) {
-	data := url.Values{}
-	data.Set("name", name)
+// UserQuery selects a page of users
+type UserQuery struct {
+	PageNum  int
+	PageSize int
+	// Cursor continues after a previous page and takes precedence over
+	// PageNum. It is opaque and passed to the user service verbatim.
+	Cursor       string
+	IncludeTotal bool // Have the user service count every user
+}
 
-	apiURL := fmt.Sprintf("%s/users", c.baseURL)
-	resp, err := c.httpClient.PostForm(apiURL, data)
+// ListUsers retrieves a page of users, newest first. Deleted users are left
+// out.
+func (c *UserClient) ListUsers(ctx context.Context, query UserQuery) (*model.UserPage, error) {
+	params := url.Values{}
+	params.Add("page_num", strconv.Itoa(query.PageNum))
+	params.Add("page_size", strconv.Itoa(query.PageSize))
+	params.Add("include_total", strconv.FormatBool(query.IncludeTotal))
+	if query.Cursor != "" {
+		params.Add("cursor", query.Cursor)
+	}
+
+	return c.getUserPage(ctx, "/users", params)
+}
+
+// SearchUsers retrieves a page of the users whose name matches q, most
+// relevant first. includeTotal has the user service count every match.
+func (c *UserClient) SearchUsers(ctx context.Context, q string, pageNum, pageSize int, includeTotal bool) (*model.UserPage, error) {
+	params := url.Values{}
+	params.Add("q", q)
+	params.Add("page_num", strconv.Itoa(pageNum))
+	params.Add("page_size", strconv.Itoa(pageSize))
+	params.Add("include_total", strconv.FormatBool(includeTotal))
+
+	return c.getUserPage(ctx, "/users/search", params)
+}
+
+// getUserPage retrieves the page of users the user service returns for path
+// and params
+func (c *UserClient) getUserPage(ctx context.Context, path string, params url.Values) (*model.UserPage, error) {
+	apiURL := fmt.Sprintf("%s%s?%s", c.baseURL, path, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := send(c.httpClient, userService, req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("user service returned status %d: %s", resp.StatusCode, string(body))
+	var data struct {
+		Users      []model.User `json:"users"`
+		NextCursor *string      `json:"next_cursor"`
+		Pagination struct {
+			Total   *int64 `json:"total"`
+			HasMore bool   `json:"has_more"`
+		} `json:"pagination"`
+	}
+	if err := decodeData(userService, resp.Body, &data); err != nil {
+		return nil, err
 	}
 
-	var serviceResp model.ServiceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&serviceResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	page := &model.UserPage{
+		Users:   data.Users,
+		Total:   data.Pagination.Total,
+		HasMore: data.Pagination.HasMore,
 	}
+	if data.NextCursor != nil {
+		page.NextCursor = *data.NextCursor
+	}
+	if page.Users == nil {
+		page.Users = []model.User{}
+	}
+	return page, nil
+}
+
+// CreateUser creates a new user. Errors reported by the user service, such
+// as a taken email address, are returned as *ServiceError.
+func (c *UserClient) CreateUser(ctx context.Context, input model.CreateUserRequest) (*model.User, error) {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/users", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := send(c.httpClient, userService, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	if !serviceResp.Result {
-		return nil, fmt.Errorf("user service error: %v", serviceResp.Errors)
+	var data struct {
+		User *model.User `json:"user"`
+	}
+	if err := decodeData(userService, resp.Body, &data); err != nil {
+		return nil, err
+	}
+	if data.User == nil {
+		return nil, &InvalidResponseError{Service: userService, Err: errors.New("no user in response")}
+	}
+
+	return data.User, nil
+}
+
+// UpdateUser updates a user. The update only succeeds if the user is still
+// at the version given by ifMatch (an ETag) or, when ifMatch is empty,
+// updatedAt. It returns the updated user and its new ETag. The user is
+// dropped from the cache.
+func (c *UserClient) UpdateUser(ctx context.Context, userID int64, name *string, updatedAt *int64, ifMatch string) (*model.User, string, error) {
+	// Whatever the outcome, the cached copy can no longer be trusted
+	defer c.InvalidateUser(userID)
+
+	payload, err := json.Marshal(struct {
+		Name      *string `json:"name,omitempty"`
+		UpdatedAt *int64  `json:"updated_at,omitempty"`
+	}{name, updatedAt})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode request: %w", err)
 	}
 
-	// Extract user from data
-	userData, ok := serviceResp.Data["user"]
-	if !ok {
-		return nil, fmt.Errorf("no user in response")
+	apiURL := fmt.Sprintf("%s/users/%d", c.baseURL, userID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
 	}
 
-	// Convert to JSON and back to proper type
-	jsonData, err := json.Marshal(userData)
+	resp, err := send(c.httpClient, userService, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal user: %w", err)
+		return nil, "", err
 	}
+	defer resp.Body.Close()
 
-	var user model.User
-	if err := json.Unmarshal(jsonData, &user); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	var data struct {
+		User *model.User `json:"user"`
+	}
+	if err := decodeData(userService, resp.Body, &data); err != nil {
+		return nil, "", err
+	}
+	if data.User == nil {
+		return nil, "", &InvalidResponseError{Service: userService, Err: errors.New("no user in response")}
 	}
 
-	return &user, nil
+	return data.User, resp.Header.Get("ETag"), nil
 }
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/metrics"
+)
+
+// newTestUserClient returns a client without a cache for a fake user service
+// that answers every request with handler
+func newTestUserClient(t *testing.T, handler http.HandlerFunc) *UserClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewUserClient(srv.URL, metrics.New(), Options{BreakerThreshold: 5}, nil)
+}
+
+func TestGetUsersLooksUpBatchInOneCall(t *testing.T) {
+	var requests []string
+	c := newTestUserClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		fmt.Fprint(w, `{"result": true, "data": {"users": [`+
+			`{"id": 3, "name": "Carol", "created_at": 3, "updated_at": 3}, `+
+			`{"id": 1, "name": "Alice", "created_at": 1, "updated_at": 1}], "missing_ids": [2]}}`)
+	})
+
+	users, missing, err := c.GetUsers(context.Background(), []int64{3, 1, 2}, false)
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(requests) != 1 || requests[0] != "/users?ids=3%2C1%2C2" {
+		t.Errorf("requests = %v, want one lookup of ids 3,1,2", requests)
+	}
+	if len(users) != 2 || users[0].Name != "Carol" || users[1].Name != "Alice" {
+		t.Errorf("users = %+v, want Carol and Alice", users)
+	}
+	if len(missing) != 1 || missing[0] != 2 {
+		t.Errorf("missing = %v, want [2]", missing)
+	}
+
+	if _, _, err := c.GetUsers(context.Background(), []int64{1}, true); err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if requests[1] != "/users?ids=1&include_deleted=true" {
+		t.Errorf("request = %s, want deleted users included", requests[1])
+	}
+}
+
+func TestGetUsersWithoutIDsMakesNoCall(t *testing.T) {
+	c := newTestUserClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	})
+
+	users, missing, err := c.GetUsers(context.Background(), nil, false)
+	if err != nil || len(users) != 0 || len(missing) != 0 {
+		t.Errorf("GetUsers(nil) = %v, %v, %v, want nothing", users, missing, err)
+	}
+}
+
+func TestClientsReturnContextErrors(t *testing.T) {
+	// The services hang until the call is given up on
+	hang := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+	users := newTestUserClient(t, hang)
+	listings := newTestListingClient(t, hang)
+
+	calls := map[string]func(ctx context.Context) error{
+		"UserClient.GetUser": func(ctx context.Context) error {
+			_, err := users.GetUser(ctx, 1)
+			return err
+		},
+		"UserClient.GetUsers": func(ctx context.Context) error {
+			_, _, err := users.GetUsers(ctx, []int64{1}, false)
+			return err
+		},
+		"ListingClient.GetListings": func(ctx context.Context) error {
+			_, err := listings.GetListings(ctx, ListingQuery{PageNum: 1, PageSize: 10})
+			return err
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		if err := call(ctx); !errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s cancelled: error = %v, want context.Canceled", name, err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+		if err := call(ctx); !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			t.Errorf("%s timed out: error = %v, want context.DeadlineExceeded", name, err)
+		}
+		cancel()
+	}
+}
@@ -1,23 +1,36 @@
 package config
 
 import (
-	"log"
-	"os"
-	"strconv"
-
-	"github.com/joho/godotenv"
+	"errors"
+	"fmt"
+	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Services ServicesConfig
+	Server      ServerConfig
+	Services    ServicesConfig
+	Upstream    UpstreamConfig
+	UserCache   UserCacheConfig
+	Enrichment  EnrichmentConfig
+	Idempotency IdempotencyConfig
+	Tracing     TracingConfig
+
+	// PrintConfig is set by --print-config: print the configuration and exit
+	PrintConfig bool
+	// Args holds the command-line arguments left after the flags
+	Args []string
+
+	// resolved records the effective value of every setting and its source
+	resolved []resolved
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Port  int
-	Debug bool
+	Port           int
+	Debug          bool
+	DrainTimeout   time.Duration // How long shutdown waits for in-flight requests
+	ReadinessDelay time.Duration // How long readiness fails before draining starts
 }
 
 // ServicesConfig holds external service URLs
@@ -26,42 +39,196 @@ type ServicesConfig struct {
 	UserServiceURL    string
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
-	}
+// UpstreamConfig holds settings for calls to the listing and user services
+type UpstreamConfig struct {
+	Timeout          time.Duration // Limit on each attempt of a call
+	MaxRetries       int           // Retries of a failed GET; other methods are not retried
+	RetryBackoff     time.Duration // Longest wait before the first retry, doubled for each later one
+	RetryMaxBackoff  time.Duration // Longest wait between retries
+	BreakerThreshold int           // Consecutive failures that open a service's circuit breaker
+	BreakerCooldown  time.Duration // How long an open breaker fails calls before a trial call
+}
 
-	config := &Config{}
+// UserCacheConfig holds settings for the cache of user service lookups
+type UserCacheConfig struct {
+	Size int           // Most users held; 0 disables the cache
+	TTL  time.Duration // How long a user is served from the cache
+}
 
-	// Server configuration
-	portStr := os.Getenv("PORT")
-	if portStr == "" {
-		portStr = "8000" // Default port
-	}
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return nil, err
-	}
-	config.Server.Port = port
+// EnrichmentConfig holds settings for enriching listings with user data
+type EnrichmentConfig struct {
+	Concurrency int    // Maximum number of concurrent user service lookups
+	Policy      string // Handling of listings whose owner cannot be looked up: "strict", "partial" or "skip"
+}
 
-	debugStr := os.Getenv("DEBUG_MODE")
-	if debugStr == "" {
-		debugStr = "true" // Default debug mode
-	}
-	config.Server.Debug = debugStr == "true"
+// IdempotencyConfig holds settings for Idempotency-Key handling
+type IdempotencyConfig struct {
+	Store  string        // Storage backend: "memory" or "sqlite"
+	DBPath string        // SQLite database path when Store is "sqlite"
+	TTL    time.Duration // How long responses are kept for replay
+}
 
-	// Services configuration
-	config.Services.ListingServiceURL = os.Getenv("LISTING_SERVICE_URL")
-	if config.Services.ListingServiceURL == "" {
-		config.Services.ListingServiceURL = "http://localhost:6000" // Default listing service URL
-	}
+// TracingConfig holds OpenTelemetry tracing settings
+type TracingConfig struct {
+	Exporter     string  // Where spans go: "none", "stdout", "file" or "otlp"
+	File         string  // File spans are appended to by the file exporter
+	OTLPEndpoint string  // URL spans are sent to by the otlp exporter
+	SampleRatio  float64 // Fraction of new traces recorded, from 0 to 1
+}
 
-	config.Services.UserServiceURL = os.Getenv("USER_SERVICE_URL")
-	if config.Services.UserServiceURL == "" {
-		config.Services.UserServiceURL = "http://localhost:7000" // Default user service URL
-	}
+// Supported values for TracingConfig.Exporter
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+	TracingOTLP   = "otlp"
+)
+
+// programName names the binary in flag usage messages
+const programName = "public-api"
+
+// settings lists every configuration value with its default and the names
+// it goes by in each layer
+var settings = []setting{
+	{
+		key: "server.port", env: "PORT", flag: "port", def: "8000",
+		usage: "Server port",
+		apply: func(c *Config, v string) (err error) { c.Server.Port, err = parsePort(v); return },
+	},
+	{
+		key: "server.debug", env: "DEBUG_MODE", flag: "debug", def: "true", isBool: true,
+		usage: "Debug mode",
+		apply: func(c *Config, v string) (err error) { c.Server.Debug, err = parseBool(v); return },
+	},
+	{
+		key: "server.shutdown_drain_timeout", env: "SHUTDOWN_DRAIN_TIMEOUT", flag: "shutdown-drain-timeout", def: "30s",
+		usage: "How long shutdown waits for in-flight requests",
+		apply: func(c *Config, v string) (err error) { c.Server.DrainTimeout, err = parseDuration(v); return },
+	},
+	{
+		key: "server.shutdown_readiness_delay", env: "SHUTDOWN_READINESS_DELAY", flag: "shutdown-readiness-delay", def: "0s",
+		usage: "How long readiness fails before draining starts",
+		apply: func(c *Config, v string) (err error) { c.Server.ReadinessDelay, err = parseDuration(v); return },
+	},
+	{
+		key: "services.listing_service_url", env: "LISTING_SERVICE_URL", flag: "listing-service", def: "http://localhost:6000",
+		usage: "Listing service URL",
+		apply: func(c *Config, v string) (err error) { c.Services.ListingServiceURL, err = parseURL(v); return },
+	},
+	{
+		key: "services.user_service_url", env: "USER_SERVICE_URL", flag: "user-service", def: "http://localhost:7000",
+		usage: "User service URL",
+		apply: func(c *Config, v string) (err error) { c.Services.UserServiceURL, err = parseURL(v); return },
+	},
+	{
+		key: "upstream.timeout", env: "UPSTREAM_TIMEOUT", flag: "upstream-timeout", def: "5s",
+		usage: "Time limit on each attempt of an upstream call (0 for none)",
+		apply: func(c *Config, v string) (err error) { c.Upstream.Timeout, err = parseDuration(v); return },
+	},
+	{
+		key: "upstream.max_retries", env: "UPSTREAM_MAX_RETRIES", flag: "upstream-max-retries", def: "2",
+		usage: "Retries of a failed upstream GET",
+		apply: func(c *Config, v string) (err error) { c.Upstream.MaxRetries, err = parseNonNegativeInt(v); return },
+	},
+	{
+		key: "upstream.retry_backoff", env: "UPSTREAM_RETRY_BACKOFF", flag: "upstream-retry-backoff", def: "100ms",
+		usage: "Longest wait before the first retry, doubled for each later one",
+		apply: func(c *Config, v string) (err error) { c.Upstream.RetryBackoff, err = parseDuration(v); return },
+	},
+	{
+		key: "upstream.retry_max_backoff", env: "UPSTREAM_RETRY_MAX_BACKOFF", flag: "upstream-retry-max-backoff", def: "1s",
+		usage: "Longest wait between retries",
+		apply: func(c *Config, v string) (err error) { c.Upstream.RetryMaxBackoff, err = parseDuration(v); return },
+	},
+	{
+		key: "upstream.breaker_threshold", env: "UPSTREAM_BREAKER_THRESHOLD", flag: "upstream-breaker-threshold", def: "5",
+		usage: "Consecutive failures that open an upstream's circuit breaker",
+		apply: func(c *Config, v string) (err error) { c.Upstream.BreakerThreshold, err = parsePositiveInt(v); return },
+	},
+	{
+		key: "upstream.breaker_cooldown", env: "UPSTREAM_BREAKER_COOLDOWN", flag: "upstream-breaker-cooldown", def: "30s",
+		usage: "How long an open circuit breaker fails calls before letting one through",
+		apply: func(c *Config, v string) (err error) { c.Upstream.BreakerCooldown, err = parseDuration(v); return },
+	},
+	{
+		key: "user_cache.size", env: "USER_CACHE_SIZE", flag: "user-cache-size", def: "1000",
+		usage: "Most users held in the user cache (0 to disable it)",
+		apply: func(c *Config, v string) (err error) { c.UserCache.Size, err = parseNonNegativeInt(v); return },
+	},
+	{
+		key: "user_cache.ttl", env: "USER_CACHE_TTL", flag: "user-cache-ttl", def: "30s",
+		usage: "How long a user is served from the user cache",
+		apply: func(c *Config, v string) (err error) { c.UserCache.TTL, err = parseDuration(v); return },
+	},
+	{
+		key: "enrichment.concurrency", env: "ENRICH_CONCURRENCY", flag: "enrich-concurrency", def: "10",
+		usage: "Maximum concurrent user service lookups per request",
+		apply: func(c *Config, v string) (err error) { c.Enrichment.Concurrency, err = parsePositiveInt(v); return },
+	},
+	{
+		key: "enrichment.policy", env: "ENRICH_POLICY", flag: "enrich-policy", def: "strict",
+		usage: "Listings whose owner cannot be looked up: strict (fail), partial (null user) or skip (leave out)",
+		apply: func(c *Config, v string) (err error) {
+			c.Enrichment.Policy, err = parseChoice(v, "strict", "partial", "skip")
+			return
+		},
+	},
+	{
+		key: "idempotency.store", env: "IDEMPOTENCY_STORE", flag: "idempotency-store", def: "memory",
+		usage: "Idempotency-Key storage: memory or sqlite",
+		apply: func(c *Config, v string) (err error) {
+			c.Idempotency.Store, err = parseChoice(v, "memory", "sqlite")
+			return
+		},
+	},
+	{
+		key: "idempotency.db_path", env: "IDEMPOTENCY_DB_PATH", flag: "idempotency-db-path", def: "idempotency.db",
+		usage: "SQLite database file for the sqlite idempotency store",
+		apply: func(c *Config, v string) error { c.Idempotency.DBPath = v; return nil },
+	},
+	{
+		key: "idempotency.ttl", env: "IDEMPOTENCY_TTL", flag: "idempotency-ttl", def: "24h",
+		usage: "How long responses to Idempotency-Key requests are replayed",
+		apply: func(c *Config, v string) (err error) { c.Idempotency.TTL, err = parseDuration(v); return },
+	},
+	{
+		key: "tracing.exporter", env: "TRACING_EXPORTER", flag: "tracing-exporter", def: TracingNone,
+		usage: "Trace exporter: none, stdout, file or otlp",
+		apply: func(c *Config, v string) (err error) {
+			c.Tracing.Exporter, err = parseChoice(v, TracingNone, TracingStdout, TracingFile, TracingOTLP)
+			return
+		},
+	},
+	{
+		key: "tracing.file", env: "TRACING_FILE", flag: "tracing-file", def: "traces.jsonl",
+		usage: "File the file trace exporter appends spans to",
+		apply: func(c *Config, v string) error { c.Tracing.File = v; return nil },
+	},
+	{
+		key: "tracing.otlp_endpoint", env: "TRACING_OTLP_ENDPOINT", flag: "tracing-otlp-endpoint", def: "http://localhost:4318/v1/traces",
+		usage: "OTLP/HTTP URL the otlp trace exporter sends spans to",
+		apply: func(c *Config, v string) (err error) { c.Tracing.OTLPEndpoint, err = parseURL(v); return },
+	},
+	{
+		key: "tracing.sample_ratio", env: "TRACING_SAMPLE_RATIO", flag: "tracing-sample-ratio", def: "1",
+		usage: "Fraction of new traces to record, from 0 to 1",
+		apply: func(c *Config, v string) (err error) { c.Tracing.SampleRatio, err = parseRatio(v); return },
+	},
+}
 
-	return config, nil
-}
\ No newline at end of file
+// validate checks rules that involve more than one setting
+func (c *Config) validate() error {
+	if c.UserCache.Size > 0 && c.UserCache.TTL == 0 {
+		return errors.New("user_cache.ttl (USER_CACHE_TTL) must be positive when the user cache is enabled")
+	}
+	if c.Idempotency.TTL == 0 {
+		return errors.New("idempotency.ttl (IDEMPOTENCY_TTL) must be positive")
+	}
+	if c.Idempotency.Store == "sqlite" && c.Idempotency.DBPath == "" {
+		return errors.New("idempotency.db_path (IDEMPOTENCY_DB_PATH) is required when the idempotency store is sqlite")
+	}
+	if c.Tracing.Exporter == TracingFile && c.Tracing.File == "" {
+		return fmt.Errorf("tracing.file (TRACING_FILE) is required when the trace exporter is %q", TracingFile)
+	}
+	return nil
+}
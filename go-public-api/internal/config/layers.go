@@ -0,0 +1,328 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// setting describes one configuration value and the name it goes by in
+// each layer
+type setting struct {
+	key    string                              // Key in the config file, e.g. "server.port"
+	env    string                              // Environment (and .env) variable, e.g. "PORT"
+	flag   string                              // Command-line flag, e.g. "port"
+	def    string                              // Default value
+	usage  string                              // Flag help text
+	isBool bool                                // The flag may be given without a value
+	secret bool                                // Masked by --print-config
+	apply  func(c *Config, value string) error // Parses and validates value into c
+}
+
+// resolved is the effective value of a setting and the layer it came from
+type resolved struct {
+	setting *setting
+	value   string
+	source  string
+}
+
+// dotenvPath is the .env file read from the working directory
+const dotenvPath = ".env"
+
+// configFileEnv names the config file when --config is not given
+const configFileEnv = "CONFIG_FILE"
+
+// Load builds the configuration from these layers, each overriding the ones
+// before it:
+//
+//  1. built-in defaults
+//  2. the YAML or TOML file named by --config or CONFIG_FILE
+//  3. the .env file in the working directory
+//  4. environment variables
+//  5. the command-line flags in args
+//
+// Empty environment and .env values count as unset. Every value is
+// validated, and all problems are reported together, each naming the layer
+// the bad value came from. Keys in the config file that match no setting
+// are errors.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet(programName, flag.ContinueOnError)
+	flagValues := make(map[string]*flagValue, len(settings))
+	for i := range settings {
+		s := &settings[i]
+		value := &flagValue{isBool: s.isBool}
+		flags.Var(value, s.flag, fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.def))
+		flagValues[s.flag] = value
+	}
+	configFile := flags.String("config", "", "YAML or TOML config file (env "+configFileEnv+")")
+	printConfig := flags.Bool("print-config", false, "Print the effective configuration and where each value came from, then exit")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	dotenv, err := readDotenv(dotenvPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The config file itself can be chosen by every layer but the file
+	path := *configFile
+	if !setFlags["config"] {
+		if value := os.Getenv(configFileEnv); value != "" {
+			path = value
+		} else {
+			path = dotenv[configFileEnv]
+		}
+	}
+	fileValues, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{
+		PrintConfig: *printConfig,
+		Args:        flags.Args(),
+	}
+	var errs []error
+	for i := range settings {
+		s := &settings[i]
+		r := resolved{setting: s, value: s.def, source: "default"}
+		if value, ok := fileValues[s.key]; ok {
+			r.value, r.source = value, "file "+path
+			delete(fileValues, s.key)
+		}
+		if value := dotenv[s.env]; value != "" {
+			r.value, r.source = value, dotenvPath+" "+s.env
+		}
+		if value := os.Getenv(s.env); value != "" {
+			r.value, r.source = value, "env "+s.env
+		}
+		if setFlags[s.flag] {
+			r.value, r.source = flagValues[s.flag].value, "flag --"+s.flag
+		}
+
+		if err := s.apply(config, r.value); err != nil {
+			shown := strconv.Quote(r.value)
+			if s.secret {
+				shown = "value"
+			}
+			errs = append(errs, fmt.Errorf("invalid %s %s from %s: %w", s.key, shown, r.source, err))
+		}
+		config.resolved = append(config.resolved, r)
+	}
+
+	unknown := make([]string, 0, len(fileValues))
+	for key := range fileValues {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("unknown setting %q in config file %s", key, path))
+	}
+
+	if len(errs) == 0 {
+		if err := config.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return config, nil
+}
+
+// Print writes the effective value of every setting and the layer it came
+// from. Passwords in secret values are masked.
+func (c *Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, r := range c.resolved {
+		value := r.value
+		if r.setting.secret {
+			value = maskSecret(value)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.setting.key, value, r.source)
+	}
+	return tw.Flush()
+}
+
+// flagValue is a string flag that remembers its raw value. Boolean settings
+// may be given as a bare --flag.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.value }
+func (v *flagValue) Set(s string) error { v.value = s; return nil }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+
+// readDotenv reads the variables in a .env file. A missing file is empty.
+func readDotenv(path string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// readConfigFile reads a YAML or TOML config file, chosen by extension, and
+// flattens its nested tables into dotted keys such as "server.port". An
+// empty path means no file.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return map[string]string{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		_, err = toml.Decode(string(data), &tree)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", tree, values)
+	return values, nil
+}
+
+// flatten adds the leaves of tree to values under their dotted keys
+func flatten(prefix string, tree map[string]interface{}, values map[string]string) {
+	for name, value := range tree {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(key, value, values)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// passwordParam matches a password in a key=value connection string
+var passwordParam = regexp.MustCompile(`(password=)(\S+)`)
+
+// maskSecret hides the password in a URL or key=value connection string
+func maskSecret(value string) string {
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			return u.String()
+		}
+	}
+	return passwordParam.ReplaceAllString(value, "${1}xxxxx")
+}
+
+// parsePort parses a TCP port number
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, errors.New("must be a port number between 1 and 65535")
+	}
+	return port, nil
+}
+
+// parsePositiveInt parses an integer of at least 1
+func parsePositiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, errors.New("must be an integer of at least 1")
+	}
+	return n, nil
+}
+
+// parseNonNegativeInt parses an integer of at least 0
+func parseNonNegativeInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.New("must be an integer of at least 0")
+	}
+	return n, nil
+}
+
+// parseBool parses true or false
+func parseBool(value string) (bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("must be true or false")
+	}
+	return b, nil
+}
+
+// parseDuration parses a non-negative duration such as "30s"
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, errors.New(`must be a non-negative duration such as "30s"`)
+	}
+	return d, nil
+}
+
+// parseURL parses an absolute http or https URL
+func parseURL(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("must be an absolute http or https URL")
+	}
+	if port := u.Port(); port != "" {
+		if _, err := parsePort(port); err != nil {
+			return "", errors.New("must have a port between 1 and 65535")
+		}
+	}
+	return value, nil
+}
+
+// parseRatio parses a number from 0 to 1
+func parseRatio(value string) (float64, error) {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(ratio >= 0 && ratio <= 1) {
+		return 0, errors.New("must be a number from 0 to 1")
+	}
+	return ratio, nil
+}
+
+// parseChoice checks that value is one of choices
+func parseChoice(value string, choices ...string) (string, error) {
+	for _, choice := range choices {
+		if value == choice {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+}
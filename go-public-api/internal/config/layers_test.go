@@ -0,0 +1,344 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// isolate runs the test in an empty working directory, so that no .env file
+// is read, and clears every variable Load looks at
+func isolate(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv(configFileEnv, "")
+	for _, s := range settings {
+		t.Setenv(s.env, "")
+	}
+}
+
+// writeFile writes a file into the working directory
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sourceOf returns the layer the setting key came from
+func sourceOf(t *testing.T, c *Config, key string) string {
+	t.Helper()
+	for _, r := range c.resolved {
+		if r.setting.key == key {
+			return r.source
+		}
+	}
+	t.Fatalf("setting %s was not resolved", key)
+	return ""
+}
+
+func TestLoadLayersOverrideEachOther(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     bool
+		dotenv   bool
+		env      bool
+		flag     bool
+		wantPort int
+		wantFrom string
+	}{
+		{name: "default", wantPort: 8000, wantFrom: "default"},
+		{name: "file over default", file: true, wantPort: 8001, wantFrom: "file config.yaml"},
+		{name: ".env over file", file: true, dotenv: true, wantPort: 8002, wantFrom: ".env PORT"},
+		{name: "env over .env", file: true, dotenv: true, env: true, wantPort: 8003, wantFrom: "env PORT"},
+		{name: "flag over env", file: true, dotenv: true, env: true, flag: true, wantPort: 8004, wantFrom: "flag --port"},
+		{name: "flag alone", flag: true, wantPort: 8004, wantFrom: "flag --port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			var args []string
+			if tt.file {
+				writeFile(t, "config.yaml", "server:\n  port: 8001\n")
+				args = append(args, "--config", "config.yaml")
+			}
+			if tt.dotenv {
+				writeFile(t, dotenvPath, "PORT=8002\n")
+			}
+			if tt.env {
+				t.Setenv("PORT", "8003")
+			}
+			if tt.flag {
+				args = append(args, "--port", "8004")
+			}
+
+			c, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if c.Server.Port != tt.wantPort {
+				t.Errorf("port = %d, want %d", c.Server.Port, tt.wantPort)
+			}
+			if from := sourceOf(t, c, "server.port"); from != tt.wantFrom {
+				t.Errorf("port came from %q, want %q", from, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestLoadReadsConfigFileNamedByEnv(t *testing.T) {
+	isolate(t)
+	writeFile(t, "config.toml", "[enrichment]\npolicy = \"skip\"\n")
+	t.Setenv(configFileEnv, "config.toml")
+
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.Enrichment.Policy != "skip" {
+		t.Errorf("policy = %q, want %q", c.Enrichment.Policy, "skip")
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "server:\n  prot: 8001\ntracing:\n  sampling: 1\n",
+		"config.toml": "[server]\nprot = 8001\n[tracing]\nsampling = 1\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			isolate(t)
+			writeFile(t, name, content)
+
+			_, err := Load([]string{"--config", name})
+			if err == nil {
+				t.Fatal("Load() succeeded, want unknown settings reported")
+			}
+			for _, key := range []string{"server.prot", "tracing.sampling"} {
+				if want := `unknown setting "` + key + `" in config file ` + name; !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadNamesSourceOfBadValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T) []string
+		want  string
+	}{
+		{
+			name: "file",
+			setup: func(t *testing.T) []string {
+				writeFile(t, "config.yaml", "server:\n  port: 0\n")
+				return []string{"--config", "config.yaml"}
+			},
+			want: `invalid server.port "0" from file config.yaml: must be a port number`,
+		},
+		{
+			name: ".env",
+			setup: func(t *testing.T) []string {
+				writeFile(t, dotenvPath, "TRACING_SAMPLE_RATIO=2\n")
+				return nil
+			},
+			want: `invalid tracing.sample_ratio "2" from .env TRACING_SAMPLE_RATIO: must be a number from 0 to 1`,
+		},
+		{
+			name: "env",
+			setup: func(t *testing.T) []string {
+				t.Setenv("ENRICH_POLICY", "lenient")
+				return nil
+			},
+			want: `invalid enrichment.policy "lenient" from env ENRICH_POLICY: must be one of strict, partial, skip`,
+		},
+		{
+			name: "flag",
+			setup: func(t *testing.T) []string {
+				return []string{"--listing-service", "localhost:6000"}
+			},
+			want: `invalid services.listing_service_url "localhost:6000" from flag --listing-service: must be an absolute http or https URL`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			_, err := Load(tt.setup(t))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryBadValue(t *testing.T) {
+	isolate(t)
+	t.Setenv("PORT", "http")
+
+	_, err := Load([]string{"--debug=maybe"})
+	if err == nil {
+		t.Fatal("Load() succeeded, want errors")
+	}
+	for _, key := range []string{"server.port", "server.debug"} {
+		if !strings.Contains(err.Error(), "invalid "+key) {
+			t.Errorf("error %q does not report %s", err, key)
+		}
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	// No setting of this service is secret yet, so print one made up for the
+	// test next to a plain one
+	dsn := &setting{key: "store.dsn", secret: true}
+	path := &setting{key: "store.path"}
+	c := &Config{resolved: []resolved{
+		{setting: dsn, value: "postgres://app:s3cret@db:5432/keys", source: "env STORE_DSN"},
+		{setting: path, value: "password=plain", source: "default"},
+	}}
+
+	var out strings.Builder
+	if err := c.Print(&out); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	if strings.Contains(out.String(), "s3cret") {
+		t.Errorf("printed config shows the password:\n%s", out.String())
+	}
+	for _, want := range []string{"postgres://app:xxxxx@db:5432/keys", "env STORE_DSN", "password=plain"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("printed config is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestLoadSetsPrintConfig(t *testing.T) {
+	isolate(t)
+	c, err := Load([]string{"--print-config"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !c.PrintConfig {
+		t.Error("PrintConfig = false, want true")
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"postgres://app:s3cret@db:5432/users?sslmode=disable", "postgres://app:xxxxx@db:5432/users?sslmode=disable"},
+		{"postgres://app@db/users", "postgres://app@db/users"},
+		{"host=db user=app password=s3cret dbname=users", "host=db user=app password=xxxxx dbname=users"},
+		{"host=db user=app", "host=db user=app"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := maskSecret(tt.value); got != tt.want {
+			t.Errorf("maskSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"1", 1, true},
+		{"7000", 7000, true},
+		{"65535", 65535, true},
+		{"0", 0, false},
+		{"65536", 0, false},
+		{"-80", 0, false},
+		{"80.5", 0, false},
+		{"http", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePort(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parsePort(%q) = %d, %v, want %d and ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"http://localhost:6000", true},
+		{"https://listings.example.com/api", true},
+		{"http://localhost:4318/v1/traces", true},
+		{"localhost:6000", false},
+		{"/listings", false},
+		{"ftp://files.example.com", false},
+		{"http://", false},
+		{"http://localhost:0", false},
+		{"http://localhost:70000", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		got, err := parseURL(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseURL(%q) error = %v, want ok %v", tt.value, err, tt.ok)
+		}
+		if tt.ok && got != tt.value {
+			t.Errorf("parseURL(%q) = %q, want the value unchanged", tt.value, got)
+		}
+	}
+}
+
+func TestParseRatio(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"0", 0, true},
+		{"0.25", 0.25, true},
+		{"1", 1, true},
+		{"-0.1", 0, false},
+		{"1.5", 0, false},
+		{"NaN", 0, false},
+		{"half", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseRatio(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseRatio(%q) = %v, %v, want %v and ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseCounts(t *testing.T) {
+	tests := []struct {
+		value       string
+		positive    bool
+		nonNegative bool
+	}{
+		{"1", true, true},
+		{"0", false, true},
+		{"-1", false, false},
+		{"2.5", false, false},
+		{"many", false, false},
+	}
+	for _, tt := range tests {
+		if _, err := parsePositiveInt(tt.value); (err == nil) != tt.positive {
+			t.Errorf("parsePositiveInt(%q) error = %v, want ok %v", tt.value, err, tt.positive)
+		}
+		if _, err := parseNonNegativeInt(tt.value); (err == nil) != tt.nonNegative {
+			t.Errorf("parseNonNegativeInt(%q) error = %v, want ok %v", tt.value, err, tt.nonNegative)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ucups/go-public-api/internal/breaker"
+)
+
+// upstreamHealth reports the circuit breaker of one upstream service
+type upstreamHealth struct {
+	Circuit             string `json:"circuit"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            *int64 `json:"opened_at"` // Microseconds; null while closed
+}
+
+// newUpstreamHealth converts a breaker status for the health response
+func newUpstreamHealth(status breaker.Status) upstreamHealth {
+	health := upstreamHealth{
+		Circuit:             status.State.String(),
+		ConsecutiveFailures: status.ConsecutiveFailures,
+	}
+	if !status.OpenedAt.IsZero() {
+		openedAt := status.OpenedAt.UnixMicro()
+		health.OpenedAt = &openedAt
+	}
+	return health
+}
+
+// Health handles GET /public-api/health. It reports the circuit breaker of
+// each upstream service. The status is "ok" while every breaker is closed
+// and "degraded" otherwise; the response is 200 either way, since the public
+// API keeps serving what it can, so this is not a readiness check.
+func (h *PublicHandler) Health(w http.ResponseWriter, r *http.Request) {
+	breakers := map[string]breaker.Status{
+		"listing": h.listingClient.Breaker(),
+		"user":    h.userClient.Breaker(),
+	}
+
+	status := "ok"
+	upstreams := make(map[string]upstreamHealth, len(breakers))
+	for name, breakerStatus := range breakers {
+		if breakerStatus.State != breaker.Closed {
+			status = "degraded"
+		}
+		upstreams[name] = newUpstreamHealth(breakerStatus)
+	}
+
+	WriteSuccess(w, map[string]interface{}{
+		"status":    status,
+		"upstreams": upstreams,
+	})
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/idempotency"
+	"github.com/ucups/go-public-api/internal/logging"
+	"github.com/ucups/go-public-api/internal/problem"
+)
+
+const (
+	// idempotencyKeyHeader carries the client's key for a create request
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks a response replayed from the store
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the longest key accepted
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes is the largest body hashed for an idempotent
+	// request
+	maxIdempotentBodyBytes = 1 << 20
+	// idempotencyLease is how long a request holds its key while it is
+	// handled. Should the process die mid-request, retries with the key are
+	// turned away with 409 for at most this long.
+	idempotencyLease = time.Minute
+)
+
+// idempotent wraps a create handler so that requests carrying an
+// Idempotency-Key are carried out at most once per key. The first request
+// claims the key for idempotencyLease; once it succeeds its response is
+// stored for the configured TTL and replayed to any retry with the same key
+// and body. A retry with a different body gets 422, and one that arrives
+// while the first request is still running gets 409. Failed and panicking
+// requests release the key so they can be retried. Requests without the
+// header, and all requests when no store is configured, go straight to
+// next.
+func (h *PublicHandler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || h.idempotencyStore == nil {
+			next(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			WriteInvalidParam(w, r, idempotencyKeyHeader, "Idempotency-Key must be 1 to 255 printable ASCII characters")
+			return
+		}
+
+		// Read the body so it can be hashed, then hand a copy to next
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				WriteError(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "request body too large")
+				return
+			}
+			WriteError(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the route, so one key cannot collide across
+		// create endpoints
+		storeKey := r.Method + " " + r.URL.Path + " " + key
+		requestHash := hashRequest(body)
+
+		record, token, err := h.idempotencyStore.Claim(r.Context(), storeKey, requestHash, time.Now().Add(idempotencyLease))
+		if err != nil {
+			WriteInternalError(w, r, err)
+			return
+		}
+
+		switch {
+		case record == nil:
+			h.runIdempotent(w, r, storeKey, token, next)
+		case record.RequestHash != requestHash:
+			WriteError(w, r, http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request body")
+		case record.Response == nil:
+			WriteError(w, r, http.StatusConflict, problem.CodeIdempotencyKeyInProgress, "a request with this Idempotency-Key is still in progress")
+		default:
+			replayResponse(w, record.Response)
+		}
+	}
+}
+
+// runIdempotent calls next for the request holding storeKey under token and
+// stores its response if it succeeded. Otherwise, including when next
+// panics, the key is released. A request that outlives its lease leaves the
+// key to whichever request claimed it since.
+func (h *PublicHandler) runIdempotent(w http.ResponseWriter, r *http.Request, storeKey, token string, next http.HandlerFunc) {
+	// The store is updated after the response has been written; finish with
+	// it even if the client has gone away
+	ctx := context.WithoutCancel(r.Context())
+	succeeded := false
+	defer func() {
+		if succeeded {
+			return
+		}
+		err := h.idempotencyStore.Release(ctx, storeKey, token)
+		if errors.Is(err, idempotency.ErrClaimLost) {
+			logging.FromContext(r.Context()).Warn("idempotency key lease expired before the request finished")
+		} else if err != nil {
+			logging.FromContext(r.Context()).Error("failed to release idempotency key", "error", err)
+		}
+	}()
+
+	recorder := &responseRecorder{ResponseWriter: w}
+	next(recorder, r)
+
+	status := recorder.statusCode()
+	if status < 200 || status >= 300 {
+		return
+	}
+
+	// The create went through, so the key stays claimed even if the response
+	// cannot be stored; retries then get 409 until the lease runs out
+	succeeded = true
+	err := h.idempotencyStore.Complete(ctx, storeKey, token, idempotency.Response{
+		StatusCode:  status,
+		ContentType: recorder.Header().Get("Content-Type"),
+		Body:        recorder.body.Bytes(),
+	}, time.Now().Add(h.idempotencyTTL))
+	if errors.Is(err, idempotency.ErrClaimLost) {
+		logging.FromContext(r.Context()).Warn("idempotency key lease expired before the request finished; response not stored")
+	} else if err != nil {
+		logging.FromContext(r.Context()).Error("failed to store idempotent response", "error", err)
+	}
+}
+
+// replayResponse writes a stored response
+func replayResponse(w http.ResponseWriter, response *idempotency.Response) {
+	if response.ContentType != "" {
+		w.Header().Set("Content-Type", response.ContentType)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(response.StatusCode)
+	w.Write(response.Body)
+}
+
+// validIdempotencyKey reports whether key is short and made of printable
+// ASCII characters
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// hashRequest returns the hex SHA-256 of a request body
+func hashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder passes a response through to the client while keeping a
+// copy of its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the body
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// statusCode returns the status written, or 200 if nothing was written
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/idempotency"
+	"github.com/ucups/go-public-api/internal/idempotency/memory"
+)
+
+// recordingStore is an in-memory idempotency store that remembers the
+// expiry times it was given
+type recordingStore struct {
+	*memory.Store
+	claimExpiresAt    time.Time
+	completeExpiresAt time.Time
+}
+
+func (s *recordingStore) Claim(ctx context.Context, key, requestHash string, expiresAt time.Time) (*idempotency.Record, string, error) {
+	s.claimExpiresAt = expiresAt
+	return s.Store.Claim(ctx, key, requestHash, expiresAt)
+}
+
+func (s *recordingStore) Complete(ctx context.Context, key, token string, response idempotency.Response, expiresAt time.Time) error {
+	s.completeExpiresAt = expiresAt
+	return s.Store.Complete(ctx, key, token, response, expiresAt)
+}
+
+const testIdempotencyTTL = 24 * time.Hour
+
+// newIdempotentHandler returns a handler with an in-memory idempotency store
+func newIdempotentHandler() (*PublicHandler, *recordingStore) {
+	store := &recordingStore{Store: memory.NewStore()}
+	return &PublicHandler{idempotencyStore: store, idempotencyTTL: testIdempotencyTTL}, store
+}
+
+// postIdempotent sends a create request with an Idempotency-Key through
+// h.idempotent(next)
+func postIdempotent(h *PublicHandler, next http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/public-api/users", strings.NewReader("name=Ada"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	h.idempotent(next)(rec, req)
+	return rec
+}
+
+func created(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"id":1}`))
+}
+
+func TestIdempotentClaimsWithLeaseAndKeepsResponseForTTL(t *testing.T) {
+	h, store := newIdempotentHandler()
+	start := time.Now()
+
+	if rec := postIdempotent(h, created); rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if lease := store.claimExpiresAt.Sub(start); lease > idempotencyLease+time.Second {
+		t.Errorf("key claimed for %v, want at most %v", lease, idempotencyLease)
+	}
+	if ttl := store.completeExpiresAt.Sub(start); ttl < testIdempotencyTTL {
+		t.Errorf("response stored for %v, want %v", ttl, testIdempotencyTTL)
+	}
+
+	rec := postIdempotent(h, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("retry was carried out again")
+	})
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"id":1}` {
+		t.Errorf("retry got %d %q, want the stored response", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("retry is missing %s", idempotentReplayedHeader)
+	}
+}
+
+func TestIdempotentReleasesKeyOnFailure(t *testing.T) {
+	h, _ := newIdempotentHandler()
+
+	postIdempotent(h, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	if rec := postIdempotent(h, created); rec.Code != http.StatusCreated {
+		t.Errorf("retry after a failure got %d, want %d", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotentReleasesKeyWhenHandlerPanics(t *testing.T) {
+	h, _ := newIdempotentHandler()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic was swallowed")
+			}
+		}()
+		postIdempotent(h, func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+	}()
+
+	if rec := postIdempotent(h, created); rec.Code != http.StatusCreated {
+		t.Errorf("retry after a panic got %d, want %d", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotentRejectsRetryWhileInProgress(t *testing.T) {
+	h, _ := newIdempotentHandler()
+
+	postIdempotent(h, func(w http.ResponseWriter, r *http.Request) {
+		if rec := postIdempotent(h, created); rec.Code != http.StatusConflict {
+			t.Errorf("concurrent retry got %d, want %d", rec.Code, http.StatusConflict)
+		}
+		created(w, r)
+	})
+}
+
+func TestIdempotentRejectsKeyReusedWithDifferentBody(t *testing.T) {
+	h, _ := newIdempotentHandler()
+	postIdempotent(h, created)
+
+	req := httptest.NewRequest(http.MethodPost, "/public-api/users", strings.NewReader("name=Grace"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request with a reused key was carried out")
+	})(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if !strings.Contains(rec.Body.String(), "idempotency_key_reused") {
+		t.Errorf("body = %s, want code idempotency_key_reused", rec.Body.String())
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsReportRequestsAndUpstreamCalls(t *testing.T) {
+	captureLogs(t)
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}
+	srv := newTestServer(t, listingsOwnedBy([]int64{1}), failing, Options{})
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(srv.URL + "/public-api/listings")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/public-api/listings",status="502"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/public-api/listings",status="502"} 2`,
+		`upstream_request_duration_seconds_count{client="listing",method="GET",status="200"} 2`,
+		`upstream_request_duration_seconds_count{client="user",method="GET",status="500"} `,
+		`upstream_request_errors_total{client="user",method="GET"} `,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+	// Only failed calls count as errors
+	if strings.Contains(string(body), `upstream_request_errors_total{client="listing"`) {
+		t.Errorf("metrics report listing errors:\n%s", body)
+	}
+}
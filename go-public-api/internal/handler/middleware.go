@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ucups/go-public-api/internal/logging"
+	"github.com/ucups/go-public-api/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// unmatchedRoute is logged and reported as the route of requests that match
+// no route
+const unmatchedRoute = "unmatched"
+
+// requestLogging assigns every request an ID, adopting a valid X-Request-ID
+// sent by the caller and generating one otherwise, and echoes it in the
+// response. The ID and a logger carrying it, the route and the trace ID are
+// added to the request context for the handler, and one line is logged per
+// request with its status and latency.
+func requestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, requestID)
+
+		attrs := []any{
+			slog.String("request_id", requestID),
+			slog.String("route", routeTemplate(r)),
+		}
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		logger := slog.Default().With(attrs...)
+		ctx := logging.WithLogger(logging.WithRequestID(r.Context(), requestID), logger)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if recorder.statusCode() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.statusCode()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
+
+// tracer creates the spans of the HTTP layer
+var tracer = otel.Tracer("github.com/ucups/go-public-api/internal/handler")
+
+// requestTracing starts a server span for every request, continuing the
+// trace in the caller's traceparent header if there is one. The span is
+// named after the method and route and is marked as failed for 5xx
+// responses.
+func requestTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.statusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// requestMetrics records the count and latency of every request by method,
+// route and status
+func requestMetrics(m *metrics.Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			m.ObserveRequest(r.Method, routeTemplate(r), recorder.statusCode(), time.Since(start))
+		})
+	}
+}
+
+// routeTemplate returns the template of the route r matched, such as
+// "/public-api/users/{id}", or unmatchedRoute
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return unmatchedRoute
+}
+
+// statusRecorder remembers the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code
+func (rec *statusRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records an implicit 200
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// statusCode returns the status written, or 200 if nothing was written
+func (rec *statusRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ucups/go-public-api/internal/logging"
+)
+
+// captureLogs sends the default logger's output to the returned buffer for
+// the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf syncBuffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, false))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf.Buffer
+}
+
+// syncBuffer is a buffer that the test server's goroutines can log to
+type syncBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+// recordRequestIDs wraps a fake service, recording the request ID of every
+// request it gets
+func recordRequestIDs(ids *[]string, mu *sync.Mutex, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*ids = append(*ids, r.Header.Get(logging.RequestIDHeader))
+		mu.Unlock()
+		next(w, r)
+	}
+}
+
+func TestRequestIDIsForwardedToServices(t *testing.T) {
+	captureLogs(t)
+	var mu sync.Mutex
+	var upstreamIDs []string
+	srv := newTestServer(t,
+		recordRequestIDs(&upstreamIDs, &mu, listingsOwnedBy([]int64{1, 2})),
+		recordRequestIDs(&upstreamIDs, &mu, fakeUsers),
+		Options{},
+	)
+
+	for _, sent := range []string{"req-7", ""} {
+		upstreamIDs = nil
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/public-api/listings", nil)
+		if sent != "" {
+			req.Header.Set(logging.RequestIDHeader, sent)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+
+		got := resp.Header.Get(logging.RequestIDHeader)
+		if sent != "" && got != sent {
+			t.Errorf("request ID = %q, want %q", got, sent)
+		}
+		if !logging.ValidRequestID(got) {
+			t.Errorf("request ID = %q, want a valid ID", got)
+		}
+		if len(upstreamIDs) != 2 || upstreamIDs[0] != got || upstreamIDs[1] != got {
+			t.Errorf("services got request IDs %q, want %q for the listing and user lookups", upstreamIDs, got)
+		}
+	}
+}
+
+func TestRequestLoggingWritesOneJSONLinePerRequest(t *testing.T) {
+	logs := captureLogs(t)
+	srv := newTestServer(t, listingsOwnedBy(nil), fakeUsers, Options{})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/public-api/users/abc", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(logs.Bytes()), &line); err != nil {
+		t.Fatalf("log %q is not one JSON line: %v", logs, err)
+	}
+	want := map[string]interface{}{
+		"msg":        "request",
+		"request_id": "req-8",
+		"route":      "/public-api/users/{id}",
+		"method":     "GET",
+		"path":       "/public-api/users/abc",
+		"status":     float64(http.StatusBadRequest),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+	if _, ok := line["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms = %v, want a duration", line["latency_ms"])
+	}
+	if strings.Count(logs.String(), "\n") != 1 {
+		t.Errorf("log = %q, want one line", logs)
+	}
+}
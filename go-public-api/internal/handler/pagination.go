@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// paramError reports an invalid query parameter
+type paramError struct {
+	Param string
+}
+
+// Error implements the error interface
+func (e *paramError) Error() string {
+	return "invalid " + e.Param
+}
+
+// write sends the error as a validation problem
+func (e *paramError) write(w http.ResponseWriter, r *http.Request) {
+	WriteInvalidParam(w, r, e.Param, e.Error())
+}
+
+// parsePageParams reads the page_num, page_size and include_total query
+// parameters shared by the list endpoints
+func parsePageParams(r *http.Request) (pageNum, pageSize int, includeTotal bool, paramErr *paramError) {
+	pageNum, pageSize, includeTotal = 1, 10, true
+	var err error
+
+	if pageNumStr := r.URL.Query().Get("page_num"); pageNumStr != "" {
+		if pageNum, err = strconv.Atoi(pageNumStr); err != nil {
+			return 0, 0, false, &paramError{Param: "page_num"}
+		}
+	}
+
+	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
+		if pageSize, err = strconv.Atoi(pageSizeStr); err != nil {
+			return 0, 0, false, &paramError{Param: "page_size"}
+		}
+	}
+
+	// Counting can be skipped for speed with include_total=false
+	if includeTotalStr := r.URL.Query().Get("include_total"); includeTotalStr != "" {
+		if includeTotal, err = strconv.ParseBool(includeTotalStr); err != nil {
+			return 0, 0, false, &paramError{Param: "include_total"}
+		}
+	}
+
+	return pageNum, pageSize, includeTotal, nil
+}
+
+// Pagination describes where a page sits in a listing
+type Pagination struct {
+	PageNum  *int    `json:"page_num"` // Null when paging by cursor
+	PageSize int     `json:"page_size"`
+	Total    *int64  `json:"total"` // Null when the count was skipped
+	HasMore  bool    `json:"has_more"`
+	Next     *string `json:"next"`
+	Prev     *string `json:"prev"`
+}
+
+// setPageLinks fills in the next and prev links of p for the page requested
+// by r. Links keep every other query parameter of r. Numbered pages link to
+// the neighbouring page numbers; cursor pages only link forward, to
+// nextCursor.
+func (p *Pagination) setPageLinks(r *http.Request, nextCursor string) {
+	link := func(param, value string) *string {
+		query := r.URL.Query()
+		query.Del("page_num")
+		query.Del("cursor")
+		query.Set(param, value)
+		u := r.URL.Path + "?" + query.Encode()
+		return &u
+	}
+
+	if p.PageNum == nil {
+		if p.HasMore && nextCursor != "" {
+			p.Next = link("cursor", nextCursor)
+		}
+		return
+	}
+
+	if p.HasMore {
+		p.Next = link("page_num", strconv.Itoa(*p.PageNum+1))
+	}
+	if *p.PageNum > 1 {
+		p.Prev = link("page_num", strconv.Itoa(*p.PageNum-1))
+	}
+}
@@ -1,100 +1,484 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/ucups/go-public-api/internal/client"
+	"github.com/ucups/go-public-api/internal/idempotency"
+	"github.com/ucups/go-public-api/internal/logging"
 	"github.com/ucups/go-public-api/internal/model"
+	"github.com/ucups/go-public-api/internal/problem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PublicHandler handles public API requests
 type PublicHandler struct {
-	listingClient *client.ListingClient
-	userClient    *client.UserClient
+	listingClient     *client.ListingClient
+	userClient        *client.UserClient
+	enrichConcurrency int
+	enrichPolicy      EnrichPolicy
+	idempotencyStore  idempotency.Store
+	idempotencyTTL    time.Duration
 }
 
+// Options holds tunable settings for the public API handler
+type Options struct {
+	// EnrichConcurrency limits the number of concurrent user lookups per request
+	EnrichConcurrency int
+	// EnrichPolicy is how GetListings handles listings whose owner cannot be
+	// looked up, unless a request overrides it. It defaults to EnrichStrict.
+	EnrichPolicy EnrichPolicy
+	// IdempotencyStore keeps responses to create requests sent with an
+	// Idempotency-Key. The header is ignored when it is nil.
+	IdempotencyStore idempotency.Store
+	// IdempotencyTTL is how long a stored response is replayed
+	IdempotencyTTL time.Duration
+}
+
+// deletedUsersMode controls how listings owned by deleted users are returned
+type deletedUsersMode string
+
+const (
+	// deletedUsersExclude leaves out listings owned by deleted users
+	deletedUsersExclude deletedUsersMode = "exclude"
+	// deletedUsersTombstone keeps those listings with a placeholder user
+	deletedUsersTombstone deletedUsersMode = "tombstone"
+)
+
+// EnrichPolicy controls how GetListings handles listings whose owner cannot
+// be looked up, because the user service does not know the owner or the
+// lookup failed
+type EnrichPolicy string
+
+const (
+	// EnrichStrict fails the whole request
+	EnrichStrict EnrichPolicy = "strict"
+	// EnrichPartial returns those listings with a null user and a warning
+	EnrichPartial EnrichPolicy = "partial"
+	// EnrichSkip leaves those listings out, with a warning
+	EnrichSkip EnrichPolicy = "skip"
+)
+
+// codeUserNotFound is the code the user service reports a missing user with
+const codeUserNotFound = "user_not_found"
+
 // NewPublicHandler creates a new public API handler
-func NewPublicHandler(listingClient *client.ListingClient, userClient *client.UserClient) *PublicHandler {
+func NewPublicHandler(listingClient *client.ListingClient, userClient *client.UserClient, opts Options) *PublicHandler {
+	if opts.EnrichConcurrency < 1 {
+		opts.EnrichConcurrency = 1
+	}
+	if opts.EnrichPolicy == "" {
+		opts.EnrichPolicy = EnrichStrict
+	}
+
 	return &PublicHandler{
-		listingClient: listingClient,
-		userClient:    userClient,
+		listingClient:     listingClient,
+		userClient:        userClient,
+		enrichConcurrency: opts.EnrichConcurrency,
+		enrichPolicy:      opts.EnrichPolicy,
+		idempotencyStore:  opts.IdempotencyStore,
+		idempotencyTTL:    opts.IdempotencyTTL,
 	}
 }
 
 // GetListings handles GET /public-api/listings
 func (h *PublicHandler) GetListings(w http.ResponseWriter, r *http.Request) {
 	// Parse pagination params
-	pageNumStr := r.URL.Query().Get("page_num")
-	pageSizeStr := r.URL.Query().Get("page_size")
+	pageNum, pageSize, includeTotal, paramErr := parsePageParams(r)
+	if paramErr != nil {
+		paramErr.write(w, r)
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
 	userIDStr := r.URL.Query().Get("user_id")
+	deletedUsersStr := r.URL.Query().Get("deleted_users")
+	enrichPolicyStr := r.URL.Query().Get("enrich_policy")
 
-	pageNum := 1
-	pageSize := 10
 	var userID *int64
+	deletedUsers := deletedUsersExclude
+	enrichPolicy := h.enrichPolicy
 
-	if pageNumStr != "" {
-		if val, err := strconv.Atoi(pageNumStr); err == nil {
-			pageNum = val
+	if userIDStr != "" {
+		if val, err := strconv.ParseInt(userIDStr, 10, 64); err == nil {
+			userID = &val
 		} else {
-			WriteError(w, http.StatusBadRequest, "invalid page_num")
+			WriteInvalidParam(w, r, "user_id", "invalid user_id")
 			return
 		}
 	}
 
-	if pageSizeStr != "" {
-		if val, err := strconv.Atoi(pageSizeStr); err == nil {
-			pageSize = val
-		} else {
-			WriteError(w, http.StatusBadRequest, "invalid page_size")
+	switch mode := deletedUsersMode(deletedUsersStr); mode {
+	case "":
+	case deletedUsersExclude, deletedUsersTombstone:
+		deletedUsers = mode
+	default:
+		WriteInvalidParam(w, r, "deleted_users", "invalid deleted_users. Supported values: 'exclude', 'tombstone'")
+		return
+	}
+
+	switch policy := EnrichPolicy(enrichPolicyStr); policy {
+	case "":
+	case EnrichStrict, EnrichPartial, EnrichSkip:
+		enrichPolicy = policy
+	default:
+		WriteInvalidParam(w, r, "enrich_policy", "invalid enrich_policy. Supported values: 'strict', 'partial', 'skip'")
+		return
+	}
+
+	// Get listings from listing service
+	page, err := h.listingClient.GetListings(r.Context(), client.ListingQuery{
+		PageNum:      pageNum,
+		PageSize:     pageSize,
+		Cursor:       cursor,
+		UserID:       userID,
+		IncludeTotal: includeTotal,
+	})
+	if err != nil {
+		WriteServiceError(w, r, err)
+		return
+	}
+
+	// Enrich each listing with user data
+	enrichedListings, warnings, err := h.enrichListings(r.Context(), page.Listings, deletedUsers, enrichPolicy)
+	if err != nil {
+		WriteServiceError(w, r, fmt.Errorf("failed to get user data: %w", err))
+		return
+	}
+
+	// The listing service's cursor is passed through untouched
+	var nextCursor interface{}
+	if page.NextCursor != "" {
+		nextCursor = page.NextCursor
+	}
+
+	pagination := Pagination{
+		PageSize: pageSize,
+		Total:    page.Total,
+		HasMore:  page.HasMore,
+	}
+	if cursor == "" {
+		pagination.PageNum = &pageNum
+	}
+	pagination.setPageLinks(r, page.NextCursor)
+
+	// Return response
+	WriteSuccess(w, map[string]interface{}{
+		"result":      true,
+		"listings":    enrichedListings,
+		"next_cursor": nextCursor,
+		"pagination":  pagination,
+		"degraded":    len(warnings) > 0,
+		"warnings":    warnings,
+	})
+}
+
+// userListingsLimit is how many of a user's most recent listings
+// GetUser embeds with with_listings=true
+const userListingsLimit = 10
+
+// GetUser handles GET /public-api/users/{id}
+func (h *PublicHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		WriteInvalidParam(w, r, "id", "invalid user id")
+		return
+	}
+
+	withListings := false
+	if withListingsStr := r.URL.Query().Get("with_listings"); withListingsStr != "" {
+		val, err := strconv.ParseBool(withListingsStr)
+		if err != nil {
+			WriteInvalidParam(w, r, "with_listings", "invalid with_listings")
 			return
 		}
+		withListings = val
 	}
 
-	if userIDStr != "" {
-		if val, err := strconv.ParseInt(userIDStr, 10, 64); err == nil {
-			userID = &val
-		} else {
-			WriteError(w, http.StatusBadRequest, "invalid user_id")
+	// Deleted users are reported as not found by the user service
+	user, err := h.userClient.GetUser(r.Context(), userID)
+	if err != nil {
+		WriteServiceError(w, r, err)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"user": user,
+	}
+
+	// Listings are only fetched once the user is known to exist
+	if withListings {
+		page, err := h.listingClient.GetListings(r.Context(), client.ListingQuery{
+			PageNum:  1,
+			PageSize: userListingsLimit,
+			UserID:   &userID,
+		})
+		if err != nil {
+			WriteServiceError(w, r, err)
 			return
 		}
+		resp["listings"] = page.Listings
 	}
 
-	// Get listings from listing service
-	listings, err := h.listingClient.GetListings(pageNum, pageSize, userID)
+	WriteSuccess(w, resp)
+}
+
+// ListUsers handles GET /public-api/users. With q it searches users by
+// name, most relevant first; otherwise it lists all users, newest first.
+func (h *PublicHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	pageNum, pageSize, includeTotal, paramErr := parsePageParams(r)
+	if paramErr != nil {
+		paramErr.write(w, r)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	cursor := r.URL.Query().Get("cursor")
+
+	// Search results are ranked, so they can only be paged by number
+	if q != "" && cursor != "" {
+		WriteInvalidParam(w, r, "cursor", "cursor cannot be combined with q")
+		return
+	}
+
+	var page *model.UserPage
+	var err error
+	if q != "" {
+		page, err = h.userClient.SearchUsers(r.Context(), q, pageNum, pageSize, includeTotal)
+	} else {
+		page, err = h.userClient.ListUsers(r.Context(), client.UserQuery{
+			PageNum:      pageNum,
+			PageSize:     pageSize,
+			Cursor:       cursor,
+			IncludeTotal: includeTotal,
+		})
+	}
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, err.Error())
+		WriteServiceError(w, r, err)
 		return
 	}
 
-	// Enrich each listing with user data
-	enrichedListings := make([]model.EnrichedListing, 0, len(listings))
+	// The user service's cursor is passed through untouched. Searches are
+	// not given one, as it could not be used.
+	var nextCursor interface{}
+	if q == "" && page.NextCursor != "" {
+		nextCursor = page.NextCursor
+	}
+
+	pagination := Pagination{
+		PageSize: pageSize,
+		Total:    page.Total,
+		HasMore:  page.HasMore,
+	}
+	if cursor == "" {
+		pagination.PageNum = &pageNum
+	}
+	pagination.setPageLinks(r, page.NextCursor)
+
+	WriteSuccess(w, map[string]interface{}{
+		"result":      true,
+		"users":       page.Users,
+		"next_cursor": nextCursor,
+		"pagination":  pagination,
+	})
+}
+
+// enrichListings attaches the owner to every listing. The distinct owner IDs
+// on the page are fetched with batch lookups of up to client.MaxUsersPerBatch
+// IDs, running at most h.enrichConcurrency batches at a time. Listings owned
+// by deleted users are dropped or given a tombstone user according to
+// deletedUsers. The result preserves the order of listings.
+//
+// Under EnrichStrict, an owner that cannot be looked up fails the whole
+// call. Otherwise each affected listing is reported in a warning and kept
+// with a nil user (EnrichPartial) or dropped (EnrichSkip).
+func (h *PublicHandler) enrichListings(ctx context.Context, listings []model.Listing, deletedUsers deletedUsersMode, policy EnrichPolicy) ([]model.EnrichedListing, []model.EnrichmentWarning, error) {
+	ctx, span := tracer.Start(ctx, "enrich listings", trace.WithAttributes(
+		attribute.Int("listings", len(listings)),
+		attribute.String("enrich_policy", string(policy)),
+	))
+	defer span.End()
+
+	userIDs := make([]int64, 0, len(listings))
+	seen := make(map[int64]bool, len(listings))
 	for _, listing := range listings {
-		user, err := h.userClient.GetUser(listing.UserID)
-		if err != nil {
-			// If user not found, skip this listing or use placeholder
-			// For now, we'll return an error
-			WriteError(w, http.StatusInternalServerError, "failed to get user data: "+err.Error())
-			return
+		if !seen[listing.UserID] {
+			seen[listing.UserID] = true
+			userIDs = append(userIDs, listing.UserID)
 		}
+	}
 
-		enrichedListing := model.EnrichedListing{
+	users, failures, err := h.fetchUsers(ctx, userIDs, policy == EnrichStrict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enrichedListings := make([]model.EnrichedListing, 0, len(listings))
+	warnings := []model.EnrichmentWarning{}
+	for _, listing := range listings {
+		enriched := model.EnrichedListing{
 			ID:          listing.ID,
 			ListingType: listing.ListingType,
 			Price:       listing.Price,
 			CreatedAt:   listing.CreatedAt,
 			UpdatedAt:   listing.UpdatedAt,
-			User:        *user,
 		}
-		enrichedListings = append(enrichedListings, enrichedListing)
+
+		user, ok := users[listing.UserID]
+		if !ok {
+			if policy == EnrichStrict {
+				return nil, nil, fmt.Errorf("user %d not found", listing.UserID)
+			}
+			warnings = append(warnings, enrichmentWarning(listing, failures[listing.UserID]))
+			if policy == EnrichPartial {
+				enrichedListings = append(enrichedListings, enriched)
+			}
+			continue
+		}
+
+		if user.DeletedAt != nil {
+			if deletedUsers == deletedUsersExclude {
+				continue
+			}
+			user = user.Tombstone()
+		}
+
+		enriched.User = &user
+		enrichedListings = append(enrichedListings, enriched)
 	}
 
-	// Return response
-	WriteSuccess(w, map[string]interface{}{
-		"result":   true,
-		"listings": enrichedListings,
-	})
+	if len(warnings) > 0 {
+		span.SetAttributes(attribute.Int("enrich_warnings", len(warnings)))
+	}
+	return enrichedListings, warnings, nil
+}
+
+// enrichmentWarning reports that the owner of listing could not be looked
+// up. err is why the lookup failed, or nil if the user service does not
+// know the owner.
+func enrichmentWarning(listing model.Listing, err error) model.EnrichmentWarning {
+	warning := model.EnrichmentWarning{
+		ListingID: listing.ID,
+		UserID:    listing.UserID,
+		Code:      codeUserNotFound,
+		Detail:    fmt.Sprintf("user %d not found", listing.UserID),
+	}
+	if err != nil {
+		p, _ := serviceProblem(err)
+		if p == nil {
+			p = problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+		}
+		warning.Code, warning.Detail = p.Code, p.Detail
+	}
+	return warning
+}
+
+// fetchUsers looks up userIDs in batches, running at most h.enrichConcurrency
+// batches concurrently. IDs the user service could not find are absent from
+// the returned users.
+//
+// With failFast, the first failed batch cancels all batches still in flight
+// and its error is returned. Otherwise every batch runs to completion, and
+// the IDs of failed batches are returned in failures with the error of their
+// batch. Either way, cancellation of ctx stops the lookups and returns its
+// error.
+func (h *PublicHandler) fetchUsers(ctx context.Context, userIDs []int64, failFast bool) (map[int64]model.User, map[int64]error, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var batches [][]int64
+	for len(userIDs) > 0 {
+		n := len(userIDs)
+		if n > client.MaxUsersPerBatch {
+			n = client.MaxUsersPerBatch
+		}
+		batches = append(batches, userIDs[:n])
+		userIDs = userIDs[n:]
+	}
+
+	results := make([][]model.User, len(batches))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, h.enrichConcurrency)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+dispatch:
+	for i, batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+
+		wg.Add(1)
+		go func(i int, batch []int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx, span := tracer.Start(ctx, "fetch users", trace.WithAttributes(attribute.Int("user_ids", len(batch))))
+			defer span.End()
+
+			// Deleted owners are fetched too, so they can be told apart
+			// from owners that never existed
+			users, _, err := h.userClient.GetUsers(ctx, batch, true)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				errs[i] = err
+				if failFast {
+					fail(err)
+				}
+				return
+			}
+			results[i] = users
+		}(i, batch)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if err := parent.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	users := make(map[int64]model.User)
+	failures := make(map[int64]error)
+	for i, batch := range batches {
+		if errs[i] != nil {
+			logging.FromContext(parent).Warn("user lookup failed, listings left unenriched", "error", errs[i], "user_ids", len(batch))
+			for _, id := range batch {
+				failures[id] = errs[i]
+			}
+			continue
+		}
+		for _, user := range results[i] {
+			users[user.ID] = user
+		}
+	}
+
+	return users, failures, nil
 }
 
 // CreateUser handles POST /public-api/users
@@ -102,18 +486,50 @@ func (h *PublicHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON request body
 	var req model.CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "invalid request body")
+		WriteError(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "invalid request body")
+		return
+	}
+
+	// Create user via user service. Client errors such as an invalid or
+	// taken email keep their status and code.
+	user, err := h.userClient.CreateUser(r.Context(), req)
+	if err != nil {
+		WriteServiceError(w, r, err)
+		return
+	}
+
+	// Return response
+	WriteSuccess(w, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// UpdateUser handles PATCH /public-api/users/{id}
+func (h *PublicHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		WriteInvalidParam(w, r, "id", "invalid user id")
+		return
+	}
+
+	// Parse JSON request body
+	var req model.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "invalid request body")
 		return
 	}
 
-	// Create user via user service
-	user, err := h.userClient.CreateUser(req.Name)
+	// Update user via user service, forwarding the client's precondition
+	user, etag, err := h.userClient.UpdateUser(r.Context(), userID, req.Name, req.UpdatedAt, r.Header.Get("If-Match"))
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, err.Error())
+		WriteServiceError(w, r, err)
 		return
 	}
 
 	// Return response
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
 	WriteSuccess(w, map[string]interface{}{
 		"user": user,
 	})
@@ -124,14 +540,14 @@ func (h *PublicHandler) CreateListing(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON request body
 	var req model.CreateListingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, http.StatusBadRequest, "invalid request body")
+		WriteError(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "invalid request body")
 		return
 	}
 
 	// Create listing via listing service
-	listing, err := h.listingClient.CreateListing(req.UserID, req.ListingType, req.Price)
+	listing, err := h.listingClient.CreateListing(r.Context(), req.UserID, req.ListingType, req.Price)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, err.Error())
+		WriteServiceError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,584 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/client"
+	"github.com/ucups/go-public-api/internal/metrics"
+	"github.com/ucups/go-public-api/internal/model"
+	"github.com/ucups/go-public-api/internal/problem"
+)
+
+// fakeUsersBody answers the user service's batch lookup for users 1 and 2
+const fakeUsersBody = `{"result": true, "data": {"users": [` +
+	`{"id": 1, "name": "Alice", "created_at": 1, "updated_at": 1}, ` +
+	`{"id": 2, "name": "Bob", "created_at": 2, "updated_at": 2}], "missing_ids": []}}`
+
+// newTestServer serves the public API in front of fake listing and user
+// services
+func newTestServer(t *testing.T, listings, users http.HandlerFunc, opts Options) *httptest.Server {
+	t.Helper()
+	listingSrv := httptest.NewServer(listings)
+	t.Cleanup(listingSrv.Close)
+	userSrv := httptest.NewServer(users)
+	t.Cleanup(userSrv.Close)
+
+	m := metrics.New()
+	clientOpts := client.Options{BreakerThreshold: 5}
+	router := SetupRoutes(
+		client.NewListingClient(listingSrv.URL, m, clientOpts),
+		client.NewUserClient(userSrv.URL, m, clientOpts, nil),
+		NewReadiness(), m, opts,
+	)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fakeUsers answers every request with fakeUsersBody
+func fakeUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fakeUsersBody))
+}
+
+// listingsResponse is the part of a GET /public-api/listings response the
+// tests look at
+type listingsResponse struct {
+	Listings []struct {
+		ID   int64 `json:"id"`
+		User *struct {
+			ID int64 `json:"id"`
+		} `json:"user"`
+	} `json:"listings"`
+	NextCursor *string `json:"next_cursor"`
+	Pagination struct {
+		PageNum *int    `json:"page_num"`
+		Total   *int64  `json:"total"`
+		HasMore bool    `json:"has_more"`
+		Next    *string `json:"next"`
+	} `json:"pagination"`
+	Degraded bool                      `json:"degraded"`
+	Warnings []model.EnrichmentWarning `json:"warnings"`
+}
+
+// getListings requests path from srv and decodes the listings response
+func getListings(t *testing.T, srv *httptest.Server, path string) listingsResponse {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d, want 200", path, resp.StatusCode)
+	}
+
+	var body listingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("GET %s: decode: %v", path, err)
+	}
+	return body
+}
+
+func TestGetListingsPassesListingServiceCursorThrough(t *testing.T) {
+	// Two pages, written as listing_service.py writes them
+	listings := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch cursor := r.URL.Query().Get("cursor"); cursor {
+		case "":
+			w.Write([]byte(`{"result": true, "listings": [` +
+				`{"id": 3, "user_id": 1, "listing_type": "rent", "price": 100, "created_at": 3, "updated_at": 3}], ` +
+				`"next_cursor": "Mzoz", "has_more": true, "total": null}`))
+		case "Mzoz":
+			w.Write([]byte(`{"result": true, "listings": [` +
+				`{"id": 2, "user_id": 2, "listing_type": "sale", "price": 200, "created_at": 2, "updated_at": 2}], ` +
+				`"next_cursor": null, "has_more": false, "total": null}`))
+		default:
+			t.Errorf("unexpected cursor %q", cursor)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"result": false, "errors": "invalid cursor"}`))
+		}
+	}
+	srv := newTestServer(t, listings, fakeUsers, Options{})
+
+	first := getListings(t, srv, "/public-api/listings?page_size=1&include_total=false")
+	if first.NextCursor == nil || *first.NextCursor != "Mzoz" {
+		t.Fatalf("first page next_cursor = %v, want Mzoz", first.NextCursor)
+	}
+	if len(first.Listings) != 1 || first.Listings[0].User == nil || first.Listings[0].User.ID != 1 {
+		t.Errorf("first page listings = %+v, want listing 3 of user 1", first.Listings)
+	}
+
+	second := getListings(t, srv, "/public-api/listings?page_size=1&include_total=false&cursor="+*first.NextCursor)
+	if len(second.Listings) != 1 || second.Listings[0].ID != 2 {
+		t.Errorf("second page listings = %+v, want listing 2", second.Listings)
+	}
+	if second.NextCursor != nil {
+		t.Errorf("last page next_cursor = %q, want null", *second.NextCursor)
+	}
+	if second.Pagination.PageNum != nil {
+		t.Errorf("cursor page page_num = %d, want null", *second.Pagination.PageNum)
+	}
+	if second.Pagination.HasMore || second.Pagination.Next != nil {
+		t.Errorf("last page has_more = %v, next = %v, want false and null", second.Pagination.HasMore, second.Pagination.Next)
+	}
+}
+
+func TestGetListingsLinksNextCursorPage(t *testing.T) {
+	listings := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result": true, "listings": [` +
+			`{"id": 3, "user_id": 1, "listing_type": "rent", "price": 100, "created_at": 3, "updated_at": 3}], ` +
+			`"next_cursor": "Mzoz", "has_more": true, "total": null}`))
+	}
+	srv := newTestServer(t, listings, fakeUsers, Options{})
+
+	page := getListings(t, srv, "/public-api/listings?page_size=1&cursor=NDo0")
+	if page.Pagination.Next == nil || !strings.Contains(*page.Pagination.Next, "cursor=Mzoz") {
+		t.Errorf("next link = %v, want one continuing from cursor Mzoz", page.Pagination.Next)
+	}
+}
+
+func TestGetListingsReportsListingServicePagination(t *testing.T) {
+	var gotIncludeTotal string
+	listings := func(w http.ResponseWriter, r *http.Request) {
+		gotIncludeTotal = r.URL.Query().Get("include_total")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result": true, "listings": [` +
+			`{"id": 4, "user_id": 2, "listing_type": "rent", "price": 100, "created_at": 4, "updated_at": 4}, ` +
+			`{"id": 3, "user_id": 1, "listing_type": "rent", "price": 100, "created_at": 3, "updated_at": 3}], ` +
+			`"next_cursor": "Mzoz", "has_more": true, "total": 5}`))
+	}
+	srv := newTestServer(t, listings, fakeUsers, Options{})
+
+	page := getListings(t, srv, "/public-api/listings?page_num=2&page_size=2")
+	if gotIncludeTotal != "true" {
+		t.Errorf("include_total sent = %q, want true", gotIncludeTotal)
+	}
+	if page.Pagination.Total == nil || *page.Pagination.Total != 5 {
+		t.Errorf("total = %v, want 5", page.Pagination.Total)
+	}
+	if !page.Pagination.HasMore {
+		t.Error("has_more = false, want true")
+	}
+	if page.Pagination.PageNum == nil || *page.Pagination.PageNum != 2 {
+		t.Errorf("page_num = %v, want 2", page.Pagination.PageNum)
+	}
+	if page.Pagination.Next == nil || !strings.Contains(*page.Pagination.Next, "page_num=3") {
+		t.Errorf("next link = %v, want one to page 3", page.Pagination.Next)
+	}
+}
+
+func TestGetListingsSkipsTotal(t *testing.T) {
+	var gotIncludeTotal string
+	listings := func(w http.ResponseWriter, r *http.Request) {
+		gotIncludeTotal = r.URL.Query().Get("include_total")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result": true, "listings": [], "next_cursor": null, "has_more": false, "total": null}`))
+	}
+	srv := newTestServer(t, listings, fakeUsers, Options{})
+
+	page := getListings(t, srv, "/public-api/listings?include_total=false")
+	if gotIncludeTotal != "false" {
+		t.Errorf("include_total sent = %q, want false", gotIncludeTotal)
+	}
+	if page.Pagination.Total != nil {
+		t.Errorf("total = %d, want null", *page.Pagination.Total)
+	}
+	if page.Pagination.HasMore || page.Pagination.Next != nil {
+		t.Errorf("has_more = %v, next = %v, want false and null", page.Pagination.HasMore, page.Pagination.Next)
+	}
+}
+
+// listingsOwnedBy answers the listing service with one listing per owner,
+// listing i owned by owners[i]
+func listingsOwnedBy(owners []int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		listings := make([]string, len(owners))
+		for i, owner := range owners {
+			listings[i] = fmt.Sprintf(`{"id": %d, "user_id": %d, "listing_type": "rent", "price": 100, "created_at": 1, "updated_at": 1}`, i+1, owner)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"result": true, "listings": [%s], "next_cursor": null, "has_more": false, "total": null}`, strings.Join(listings, ", "))
+	}
+}
+
+// writeUsers answers a batch lookup with a user for every requested ID
+func writeUsers(w http.ResponseWriter, r *http.Request) {
+	var users []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		users = append(users, fmt.Sprintf(`{"id": %s, "name": "User %s", "created_at": 1, "updated_at": 1}`, id, id))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"result": true, "data": {"users": [%s], "missing_ids": []}}`, strings.Join(users, ", "))
+}
+
+func TestGetListingsEnrichesConcurrentlyInListingOrder(t *testing.T) {
+	// Enough distinct owners, out of order, for three batch lookups
+	owners := make([]int64, 2*client.MaxUsersPerBatch+10)
+	for i := range owners {
+		owners[i] = int64(len(owners) - i)
+	}
+
+	var inFlight, maxInFlight, lookups atomic.Int32
+	users := func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		writeUsers(w, r)
+	}
+	srv := newTestServer(t, listingsOwnedBy(owners), users, Options{EnrichConcurrency: 2})
+
+	page := getListings(t, srv, "/public-api/listings")
+	if got := lookups.Load(); got != 3 {
+		t.Errorf("user service got %d lookups, want 3", got)
+	}
+	if got := maxInFlight.Load(); got != 2 {
+		t.Errorf("at most %d lookups ran at once, want 2", got)
+	}
+	if len(page.Listings) != len(owners) {
+		t.Fatalf("got %d listings, want %d", len(page.Listings), len(owners))
+	}
+	for i, listing := range page.Listings {
+		if listing.ID != int64(i+1) || listing.User == nil || listing.User.ID != owners[i] {
+			t.Fatalf("listing %d = %+v, want listing %d of user %d", i, listing, i+1, owners[i])
+		}
+	}
+}
+
+func TestGetListingsCancelsLookupsOnFirstFailure(t *testing.T) {
+	owners := make([]int64, client.MaxUsersPerBatch+1)
+	for i := range owners {
+		owners[i] = int64(i + 1)
+	}
+
+	cancelled := make(chan struct{}, 1)
+	users := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Query().Get("ids"), "1,") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// The other batch hangs until the public API gives up on it
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-time.After(5 * time.Second):
+		}
+	}
+	srv := newTestServer(t, listingsOwnedBy(owners), users, Options{EnrichConcurrency: 2})
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/public-api/listings?enrich_policy=strict")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v, want it to fail fast", elapsed)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("the remaining lookup was not cancelled")
+	}
+}
+
+// usersExcept answers a batch lookup with a user for every requested ID
+// but missing
+func usersExcept(missing int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var users []string
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if id != strconv.FormatInt(missing, 10) {
+				users = append(users, fmt.Sprintf(`{"id": %s, "name": "User %s", "created_at": 1, "updated_at": 1}`, id, id))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"result": true, "data": {"users": [%s], "missing_ids": [%d]}}`, strings.Join(users, ", "), missing)
+	}
+}
+
+// listingUsers returns the owner ID of each listing in body, 0 for a null
+// user
+func listingUsers(body listingsResponse) []int64 {
+	ids := make([]int64, len(body.Listings))
+	for i, listing := range body.Listings {
+		if listing.User != nil {
+			ids[i] = listing.User.ID
+		}
+	}
+	return ids
+}
+
+func TestGetListingsEnrichPolicies(t *testing.T) {
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type": "about:blank", "title": "Bad Request", "status": 400, "code": "invalid_ids", "detail": "ids are invalid"}`)
+	}
+	missingWarning := model.EnrichmentWarning{ListingID: 2, UserID: 7, Code: "user_not_found", Detail: "user 7 not found"}
+	failedWarnings := []model.EnrichmentWarning{
+		{ListingID: 1, UserID: 1, Code: "invalid_ids", Detail: "ids are invalid"},
+		{ListingID: 2, UserID: 7, Code: "invalid_ids", Detail: "ids are invalid"},
+	}
+
+	tests := []struct {
+		name     string
+		users    http.HandlerFunc
+		opts     Options
+		query    string
+		owners   []int64
+		warnings []model.EnrichmentWarning
+	}{
+		{
+			name: "partial keeps listing without user", users: usersExcept(7),
+			query: "?enrich_policy=partial", owners: []int64{1, 0, 3},
+			warnings: []model.EnrichmentWarning{missingWarning},
+		},
+		{
+			name: "skip drops listing", users: usersExcept(7),
+			query: "?enrich_policy=skip", owners: []int64{1, 3},
+			warnings: []model.EnrichmentWarning{missingWarning},
+		},
+		{
+			name: "partial default", users: usersExcept(7), opts: Options{EnrichPolicy: EnrichPartial},
+			owners: []int64{1, 0, 3}, warnings: []model.EnrichmentWarning{missingWarning},
+		},
+		{
+			name: "partial keeps listings of failed lookup", users: failing,
+			query: "?enrich_policy=partial", owners: []int64{0, 0, 0},
+			warnings: append(failedWarnings, model.EnrichmentWarning{ListingID: 3, UserID: 3, Code: "invalid_ids", Detail: "ids are invalid"}),
+		},
+		{
+			name: "skip drops listings of failed lookup", users: failing,
+			query: "?enrich_policy=skip", owners: []int64{},
+			warnings: append(failedWarnings, model.EnrichmentWarning{ListingID: 3, UserID: 3, Code: "invalid_ids", Detail: "ids are invalid"}),
+		},
+		{
+			name: "nothing to warn about", users: writeUsers,
+			query: "?enrich_policy=skip", owners: []int64{1, 7, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, listingsOwnedBy([]int64{1, 7, 3}), tt.users, tt.opts)
+			body := getListings(t, srv, "/public-api/listings"+tt.query)
+
+			if got := listingUsers(body); fmt.Sprint(got) != fmt.Sprint(tt.owners) {
+				t.Errorf("listing users = %v, want %v", got, tt.owners)
+			}
+			if body.Degraded != (len(tt.warnings) > 0) {
+				t.Errorf("degraded = %v, want %v", body.Degraded, len(tt.warnings) > 0)
+			}
+			// Warnings are always a list, empty when nothing was degraded
+			if body.Warnings == nil || fmt.Sprint(body.Warnings) != fmt.Sprint(tt.warnings) {
+				t.Errorf("warnings = %+v, want %+v", body.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestGetListingsStrictPolicyFailsOnMissingUser(t *testing.T) {
+	captureLogs(t)
+	srv := newTestServer(t, listingsOwnedBy([]int64{1, 7}), usersExcept(7), Options{EnrichPolicy: EnrichPartial})
+
+	for query, status := range map[string]int{
+		"?enrich_policy=strict":  http.StatusInternalServerError,
+		"?enrich_policy=lenient": http.StatusBadRequest,
+	} {
+		resp, err := http.Get(srv.URL + "/public-api/listings" + query)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("GET %s status = %d, want %d", query, resp.StatusCode, status)
+		}
+	}
+}
+
+// get requests path from srv, decodes the JSON response into body and
+// returns the status code
+func get(t *testing.T, srv *httptest.Server, path string, body interface{}) int {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		t.Fatalf("GET %s: decode: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+// userResponse is the part of a GET /public-api/users/{id} response the
+// tests look at
+type userResponse struct {
+	User struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"user"`
+	Listings *[]model.Listing `json:"listings"`
+}
+
+func TestGetUserEmbedsListingsOnRequest(t *testing.T) {
+	captureLogs(t)
+	var listingQueries []string
+	listings := func(w http.ResponseWriter, r *http.Request) {
+		listingQueries = append(listingQueries, r.URL.RawQuery)
+		listingsOwnedBy([]int64{7, 7})(w, r)
+	}
+	users := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/7" {
+			t.Errorf("user service got %s, want /users/7", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"result": true, "data": {"user": {"id": 7, "name": "Jane", "created_at": 1, "updated_at": 1}}}`)
+	}
+	srv := newTestServer(t, listings, users, Options{})
+
+	var body userResponse
+	if status := get(t, srv, "/public-api/users/7", &body); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if body.User.ID != 7 || body.User.Name != "Jane" || body.Listings != nil || len(listingQueries) != 0 {
+		t.Errorf("without with_listings got %+v after %d listing calls, want the user alone", body, len(listingQueries))
+	}
+
+	body = userResponse{}
+	if status := get(t, srv, "/public-api/users/7?with_listings=true", &body); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if body.Listings == nil || len(*body.Listings) != 2 {
+		t.Fatalf("listings = %v, want the user's 2 listings", body.Listings)
+	}
+	if len(listingQueries) != 1 {
+		t.Fatalf("listing service got %d calls, want 1", len(listingQueries))
+	}
+	query, _ := url.ParseQuery(listingQueries[0])
+	if query.Get("user_id") != "7" || query.Get("page_num") != "1" || query.Get("page_size") != "10" {
+		t.Errorf("listing query = %s, want the first 10 listings of user 7", listingQueries[0])
+	}
+}
+
+func TestGetUserRejectsBadParams(t *testing.T) {
+	captureLogs(t)
+	unexpected := func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	}
+	srv := newTestServer(t, unexpected, unexpected, Options{})
+
+	for path, param := range map[string]string{
+		"/public-api/users/abc":                  "id",
+		"/public-api/users/7?with_listings=some": "with_listings",
+		"/public-api/users?q=jane&cursor=abc":    "cursor",
+	} {
+		var p problem.Problem
+		status := get(t, srv, path, &p)
+		if status != http.StatusBadRequest || len(p.Errors) != 1 || p.Errors[0].Field != param {
+			t.Errorf("GET %s = %d %+v, want 400 naming %s", path, status, p, param)
+		}
+	}
+}
+
+func TestGetUserPassesNotFoundThrough(t *testing.T) {
+	captureLogs(t)
+	listings := func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("listings fetched for a missing user")
+	}
+	users := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"type": "about:blank", "title": "Not Found", "status": 404, "code": "user_not_found", "detail": "user not found"}`)
+	}
+	srv := newTestServer(t, listings, users, Options{})
+
+	var p problem.Problem
+	if status := get(t, srv, "/public-api/users/7?with_listings=true", &p); status != http.StatusNotFound || p.Code != "user_not_found" {
+		t.Errorf("GET = %d %+v, want 404 user_not_found", status, p)
+	}
+}
+
+// usersPageResponse is the part of a GET /public-api/users response the
+// tests look at
+type usersPageResponse struct {
+	Users []struct {
+		ID int64 `json:"id"`
+	} `json:"users"`
+	NextCursor *string `json:"next_cursor"`
+	Pagination struct {
+		PageNum *int    `json:"page_num"`
+		Next    *string `json:"next"`
+	} `json:"pagination"`
+}
+
+func TestListUsersSearchesOrPagesByCursor(t *testing.T) {
+	captureLogs(t)
+	var requests []string
+	users := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		fmt.Fprint(w, `{"result": true, "data": {"users": [{"id": 3, "name": "Jane", "created_at": 1, "updated_at": 1}], `+
+			`"next_cursor": "next-page", "pagination": {"total": null, "has_more": true}}}`)
+	}
+	srv := newTestServer(t, listingsOwnedBy(nil), users, Options{})
+
+	tests := []struct {
+		path       string
+		upstream   string
+		nextCursor string
+		pageNum    bool
+		next       string
+	}{
+		{
+			// Ranked search results are paged by number only
+			path:     "/public-api/users?q=+jane+&page_size=5",
+			upstream: "/users/search?include_total=true&page_num=1&page_size=5&q=jane",
+			pageNum:  true, next: "/public-api/users?page_num=2&page_size=5&q=+jane+",
+		},
+		{
+			path:       "/public-api/users?cursor=this-page",
+			upstream:   "/users?cursor=this-page&include_total=true&page_num=1&page_size=10",
+			nextCursor: "next-page", next: "/public-api/users?cursor=next-page",
+		},
+	}
+	for _, tt := range tests {
+		requests = nil
+		var body usersPageResponse
+		if status := get(t, srv, tt.path, &body); status != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want 200", tt.path, status)
+		}
+		if len(requests) != 1 || requests[0] != tt.upstream {
+			t.Errorf("GET %s: user service got %v, want %s", tt.path, requests, tt.upstream)
+		}
+		if len(body.Users) != 1 || body.Users[0].ID != 3 {
+			t.Errorf("GET %s: users = %+v, want user 3", tt.path, body.Users)
+		}
+		if got := body.NextCursor; (got == nil) != (tt.nextCursor == "") || got != nil && *got != tt.nextCursor {
+			t.Errorf("GET %s: next_cursor = %v, want %q", tt.path, got, tt.nextCursor)
+		}
+		if (body.Pagination.PageNum != nil) != tt.pageNum {
+			t.Errorf("GET %s: page_num = %v, want it set %v", tt.path, body.Pagination.PageNum, tt.pageNum)
+		}
+		if next := body.Pagination.Next; next == nil || *next != tt.next {
+			t.Errorf("GET %s: next = %v, want %s", tt.path, next, tt.next)
+		}
+	}
+}
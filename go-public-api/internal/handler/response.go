@@ -1,10 +1,21 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/ucups/go-public-api/internal/breaker"
+	"github.com/ucups/go-public-api/internal/client"
+	"github.com/ucups/go-public-api/internal/logging"
+	"github.com/ucups/go-public-api/internal/problem"
 )
 
+// StatusClientClosedRequest is the non-standard status recorded when the
+// client cancels its request before a response is written
+const StatusClientClosedRequest = 499
+
 // WriteJSON writes a JSON response
 func WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -17,9 +28,85 @@ func WriteSuccess(w http.ResponseWriter, data interface{}) {
 	WriteJSON(w, http.StatusOK, data)
 }
 
-// WriteError writes an error response
-func WriteError(w http.ResponseWriter, statusCode int, message string) {
-	WriteJSON(w, statusCode, map[string]interface{}{
-		"error": message,
-	})
+// WriteProblem writes p as an application/problem+json response, tagged
+// with the request ID and path of r
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *problem.Problem) {
+	p.RequestID = logging.RequestID(r.Context())
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", problem.ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WriteError writes a problem response with the given status, code and
+// detail
+func WriteError(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	WriteProblem(w, r, problem.New(statusCode, code, detail))
+}
+
+// WriteInvalidParam writes a 400 validation problem for a single invalid
+// parameter
+func WriteInvalidParam(w http.ResponseWriter, r *http.Request, param, message string) {
+	p := problem.New(http.StatusBadRequest, problem.CodeValidationFailed, message)
+	p.Errors = []problem.FieldError{{Field: param, Code: "invalid", Message: message}}
+	WriteProblem(w, r, p)
+}
+
+// WriteInternalError logs err with the request's logger and writes a 500
+// problem without its details
+func WriteInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("internal error", "error", err)
+	WriteError(w, r, http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+}
+
+// WriteServiceError writes an error returned by a service client as the
+// problem serviceProblem describes. Upstream failures are logged; errors
+// that are not service errors are internal.
+func WriteServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	p, logMsg := serviceProblem(err)
+	if p == nil {
+		WriteInternalError(w, r, err)
+		return
+	}
+	if logMsg != "" {
+		logging.FromContext(r.Context()).Error(logMsg, "error", err)
+	}
+	WriteProblem(w, r, p)
+}
+
+// serviceProblem describes an error returned by a service client. Requests
+// cancelled by the client get 499 and requests that ran out of time 504. A
+// 4xx problem reported by the service is passed on with its status, code
+// and field errors, since it concerns the client's input. The service
+// failing, being unreachable or sending a response that cannot be
+// understood is reported as 502, and a call rejected because the service's
+// circuit breaker is open as 503. For these upstream failures logMsg is the
+// message to log the error with. The problem is nil if err is not a
+// service error.
+func serviceProblem(err error) (p *problem.Problem, logMsg string) {
+	var serviceErr *client.ServiceError
+	var unavailableErr *client.UnavailableError
+	var invalidErr *client.InvalidResponseError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return problem.New(StatusClientClosedRequest, problem.CodeRequestCancelled, "request cancelled"), ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return problem.New(http.StatusGatewayTimeout, problem.CodeUpstreamTimeout, "upstream request timed out"), ""
+	case errors.As(err, &serviceErr) && serviceErr.StatusCode() < http.StatusInternalServerError:
+		upstream := *serviceErr.Problem
+		p := problem.New(upstream.Status, upstream.Code, upstream.Detail)
+		p.Errors = upstream.Errors
+		return p, ""
+	case errors.As(err, &serviceErr):
+		return problem.New(http.StatusBadGateway, problem.CodeUpstreamError, serviceErr.Service+" failed"), "upstream error"
+	case errors.As(err, &unavailableErr) && errors.Is(err, breaker.ErrOpen):
+		return problem.New(http.StatusServiceUnavailable, problem.CodeUpstreamCircuitOpen, unavailableErr.Service+" is unavailable, try again later"), ""
+	case errors.As(err, &unavailableErr):
+		return problem.New(http.StatusBadGateway, problem.CodeUpstreamUnavailable, unavailableErr.Service+" is unavailable"), "upstream unavailable"
+	case errors.As(err, &invalidErr):
+		return problem.New(http.StatusBadGateway, problem.CodeUpstreamError, "invalid response from "+invalidErr.Service), "invalid upstream response"
+	default:
+		return nil, ""
+	}
 }
@@ -1,21 +1,46 @@
 package handler
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
 	"github.com/ucups/go-public-api/internal/client"
+	"github.com/ucups/go-public-api/internal/metrics"
+	"github.com/ucups/go-public-api/internal/problem"
 )
 
-// SetupRoutes configures all HTTP routes
-func SetupRoutes(listingClient *client.ListingClient, userClient *client.UserClient) *mux.Router {
-	handler := NewPublicHandler(listingClient, userClient)
+// SetupRoutes configures all HTTP routes. readiness backs the readiness
+// check, and m records request metrics and is served on /metrics.
+func SetupRoutes(listingClient *client.ListingClient, userClient *client.UserClient, readiness *Readiness, m *metrics.Metrics, opts Options) *mux.Router {
+	handler := NewPublicHandler(listingClient, userClient, opts)
+
+	// Every request is traced, logged and measured, including those that
+	// match no route
+	observe := func(next http.Handler) http.Handler {
+		return requestTracing(requestLogging(requestMetrics(m)(next)))
+	}
 
 	router := mux.NewRouter()
+	router.Use(observe)
+	router.NotFoundHandler = observe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusNotFound, problem.CodeNotFound, "no route matches "+r.URL.Path)
+	}))
+	router.MethodNotAllowedHandler = observe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	}))
+
+	router.Handle("/metrics", m.Handler()).Methods("GET")
 
 	// Public API routes
 	router.HandleFunc("/public-api/ping", handler.Ping).Methods("GET")
+	router.HandleFunc("/public-api/ready", readiness.Ready).Methods("GET")
+	router.HandleFunc("/public-api/health", handler.Health).Methods("GET")
 	router.HandleFunc("/public-api/listings", handler.GetListings).Methods("GET")
-	router.HandleFunc("/public-api/listings", handler.CreateListing).Methods("POST")
-	router.HandleFunc("/public-api/users", handler.CreateUser).Methods("POST")
+	router.HandleFunc("/public-api/listings", handler.idempotent(handler.CreateListing)).Methods("POST")
+	router.HandleFunc("/public-api/users", handler.ListUsers).Methods("GET")
+	router.HandleFunc("/public-api/users", handler.idempotent(handler.CreateUser)).Methods("POST")
+	router.HandleFunc("/public-api/users/{id}", handler.GetUser).Methods("GET")
+	router.HandleFunc("/public-api/users/{id}", handler.UpdateUser).Methods("PATCH")
 
 	return router
 }
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	installSpans sync.Once
+	spans        = tracetest.NewSpanRecorder()
+)
+
+// tracedSpans installs a tracer provider recording into spans. Tracers are
+// bound to the first provider installed, so the tests share one recorder
+// and tell their spans apart by trace ID.
+func tracedSpans() {
+	installSpans.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+}
+
+// spansOf returns the ended spans of the trace with the given ID, by name
+func spansOf(traceID string) map[string]sdktrace.ReadOnlySpan {
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			byName[span.Name()] = span
+		}
+	}
+	return byName
+}
+
+// recordTraceparents wraps a fake service, recording the traceparent of
+// every request it gets
+func recordTraceparents(seen *[]string, mu *sync.Mutex, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*seen = append(*seen, r.Header.Get("traceparent"))
+		mu.Unlock()
+		next(w, r)
+	}
+}
+
+func TestGetListingsTracesListingFetchAndEnrichment(t *testing.T) {
+	tracedSpans()
+	captureLogs(t)
+	var mu sync.Mutex
+	var listingParents, userParents []string
+	srv := newTestServer(t,
+		recordTraceparents(&listingParents, &mu, listingsOwnedBy([]int64{1, 2})),
+		recordTraceparents(&userParents, &mu, fakeUsers),
+		Options{},
+	)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/public-api/listings", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+
+	got := spansOf(traceID)
+	root, ok := got["GET /public-api/listings"]
+	if !ok {
+		t.Fatalf("spans = %v, want a server span for GET /public-api/listings", got)
+	}
+	if root.SpanKind() != trace.SpanKindServer || root.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("root span kind %v, parent %v, want a server span under the caller's span", root.SpanKind(), root.Parent())
+	}
+
+	parents := map[string]string{
+		"GET listing service": "GET /public-api/listings",
+		"enrich listings":     "GET /public-api/listings",
+		"fetch users":         "enrich listings",
+		"GET user service":    "fetch users",
+	}
+	for name, parent := range parents {
+		span, ok := got[name]
+		if !ok {
+			t.Errorf("spans = %v, want %s", got, name)
+			continue
+		}
+		if span.Parent().SpanID() != got[parent].SpanContext().SpanID() {
+			t.Errorf("%s parent = %v, want %s", name, span.Parent().SpanID(), parent)
+		}
+	}
+
+	// The services are called within their client spans, so their own
+	// spans join the trace
+	clients := map[string][]string{"GET listing service": listingParents, "GET user service": userParents}
+	for name, seen := range clients {
+		want := "00-" + traceID + "-" + got[name].SpanContext().SpanID().String() + "-01"
+		if len(seen) != 1 || seen[0] != want {
+			t.Errorf("%s sent traceparent %q, want %q", name, seen, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package memory provides an idempotency store that keeps records in process
+// memory. Records are lost on restart and are not shared between instances,
+// so it suits development and single-instance deployments.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/idempotency"
+)
+
+// sweepInterval is how often expired records are purged
+const sweepInterval = time.Minute
+
+// Store implements idempotency.Store in memory
+type Store struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// entry is a record and the token of the claim that created it
+type entry struct {
+	record idempotency.Record
+	token  string
+}
+
+// NewStore creates an empty in-memory idempotency store
+func NewStore() *Store {
+	return &Store{
+		entries:   make(map[string]*entry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Claim reserves key unless an unexpired record holds it
+func (s *Store) Claim(ctx context.Context, key, requestHash string, expiresAt time.Time) (*idempotency.Record, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.record.ExpiresAt) {
+		return copyRecord(&e.record), "", nil
+	}
+
+	token := idempotency.NewToken()
+	s.entries[key] = &entry{
+		record: idempotency.Record{
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   expiresAt,
+		},
+		token: token,
+	}
+	return nil, token, nil
+}
+
+// Complete stores the response for a key claimed under token until
+// expiresAt
+func (s *Store) Complete(ctx context.Context, key, token string, response idempotency.Response, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.token != token {
+		return idempotency.ErrClaimLost
+	}
+	response.Body = append([]byte(nil), response.Body...)
+	e.record.Response = &response
+	e.record.ExpiresAt = expiresAt
+	return nil
+}
+
+// Release removes a key claimed under token
+func (s *Store) Release(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.token != token {
+		return idempotency.ErrClaimLost
+	}
+	delete(s.entries, key)
+	return nil
+}
+
+// Close is a no-op for the in-memory store
+func (s *Store) Close() error {
+	return nil
+}
+
+// sweep purges expired records at most once per sweepInterval. The caller
+// must hold s.mu.
+func (s *Store) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	for key, e := range s.entries {
+		if !now.Before(e.record.ExpiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// copyRecord returns a copy of record that shares no memory with the store
+func copyRecord(record *idempotency.Record) *idempotency.Record {
+	c := *record
+	if record.Response != nil {
+		response := *record.Response
+		response.Body = append([]byte(nil), record.Response.Body...)
+		c.Response = &response
+	}
+	return &c
+}
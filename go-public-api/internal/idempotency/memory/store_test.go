@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/ucups/go-public-api/internal/idempotency"
+	"github.com/ucups/go-public-api/internal/idempotency/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) idempotency.Store {
+		return NewStore()
+	})
+}
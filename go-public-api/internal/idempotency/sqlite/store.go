@@ -0,0 +1,178 @@
+// Package sqlite provides an idempotency store backed by SQLite, so that
+// stored responses survive restarts.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/ucups/go-public-api/internal/idempotency"
+)
+
+// schema creates the table that holds idempotency records. Response columns
+// are NULL while the request holding the key is in progress, and token
+// identifies that request's claim.
+const schema = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	request_hash TEXT NOT NULL,
+	token TEXT NOT NULL DEFAULT '',
+	status_code INTEGER,
+	content_type TEXT,
+	body BLOB,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+`
+
+// Store implements idempotency.Store with SQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore opens the SQLite database at dbPath and creates the idempotency
+// table if needed
+func NewStore(dbPath string) (*Store, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open idempotency database: %w", err)
+	}
+
+	// SQLite allows a single writer; serialising access avoids "database is
+	// locked" errors between concurrent claims
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create idempotency table: %w", err)
+	}
+	if err := addTokenColumn(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// addTokenColumn adds the token column to a table created before claims
+// carried tokens. Records in such a table can no longer be completed or
+// released and are left to expire.
+func addTokenColumn(db *sql.DB) error {
+	var columns int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('idempotency_keys') WHERE name = 'token'`).Scan(&columns)
+	if err != nil {
+		return fmt.Errorf("failed to inspect idempotency table: %w", err)
+	}
+	if columns > 0 {
+		return nil
+	}
+	if _, err := db.Exec(`ALTER TABLE idempotency_keys ADD COLUMN token TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("failed to add token column to idempotency table: %w", err)
+	}
+	return nil
+}
+
+// Claim reserves key unless an unexpired record holds it. Expired records
+// are purged first.
+func (s *Store) Claim(ctx context.Context, key, requestHash string, expiresAt time.Time) (*idempotency.Record, string, error) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now().UnixMicro()); err != nil {
+		return nil, "", fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+
+	// The key can be released between the insert and the select; try again
+	// when that happens
+	token := idempotency.NewToken()
+	for attempt := 0; attempt < 3; attempt++ {
+		result, err := s.db.ExecContext(ctx,
+			`INSERT INTO idempotency_keys (key, request_hash, token, expires_at) VALUES (?, ?, ?, ?) ON CONFLICT(key) DO NOTHING`,
+			key, requestHash, token, expiresAt.UnixMicro())
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		if claimed, err := result.RowsAffected(); err != nil {
+			return nil, "", fmt.Errorf("failed to claim idempotency key: %w", err)
+		} else if claimed == 1 {
+			return nil, token, nil
+		}
+
+		record, err := s.get(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		return record, "", err
+	}
+	return nil, "", fmt.Errorf("failed to claim idempotency key: key %q keeps changing", key)
+}
+
+// get loads the record for key
+func (s *Store) get(ctx context.Context, key string) (*idempotency.Record, error) {
+	var (
+		record      = idempotency.Record{Key: key}
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+		body        []byte
+		expiresAt   int64
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT request_hash, status_code, content_type, body, expires_at FROM idempotency_keys WHERE key = ?`,
+		key).Scan(&record.RequestHash, &statusCode, &contentType, &body, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+
+	record.ExpiresAt = time.UnixMicro(expiresAt)
+	if statusCode.Valid {
+		record.Response = &idempotency.Response{
+			StatusCode:  int(statusCode.Int64),
+			ContentType: contentType.String,
+			Body:        body,
+		}
+	}
+	return &record, nil
+}
+
+// Complete stores the response for a key claimed under token until
+// expiresAt
+func (s *Store) Complete(ctx context.Context, key, token string, response idempotency.Response, expiresAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code = ?, content_type = ?, body = ?, expires_at = ? WHERE key = ? AND token = ?`,
+		response.StatusCode, response.ContentType, response.Body, expiresAt.UnixMicro(), key, token)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return claimHeld(result)
+}
+
+// Release removes a key claimed under token
+func (s *Store) Release(ctx context.Context, key, token string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = ? AND token = ?`, key, token)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return claimHeld(result)
+}
+
+// claimHeld returns idempotency.ErrClaimLost unless a statement conditional
+// on a claim's token affected its record
+func claimHeld(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check idempotency claim: %w", err)
+	}
+	if affected == 0 {
+		return idempotency.ErrClaimLost
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/idempotency"
+	"github.com/ucups/go-public-api/internal/idempotency/storetest"
+)
+
+// newTestStore opens a store on a fresh database file
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(filepath.Join(t.TempDir(), "idempotency.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) idempotency.Store {
+		return newTestStore(t)
+	})
+}
+
+func TestClaimPurgesExpiredKeys(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		if _, _, err := store.Claim(ctx, key, "hash", time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("Claim(%q) failed: %v", key, err)
+		}
+	}
+	if _, _, err := store.Claim(ctx, "c", "hash", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+
+	var keys int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM idempotency_keys`).Scan(&keys); err != nil {
+		t.Fatal(err)
+	}
+	if keys != 1 {
+		t.Errorf("table holds %d keys, want only the unexpired one", keys)
+	}
+}
+
+func TestNewStoreAddsTokenColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE idempotency_keys (
+		key TEXT PRIMARY KEY,
+		request_hash TEXT NOT NULL,
+		status_code INTEGER,
+		content_type TEXT,
+		body BLOB,
+		expires_at INTEGER NOT NULL
+	)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore on a table without tokens failed: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	_, token, err := store.Claim(ctx, "a", "hash", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if err := store.Release(ctx, "a", token); err != nil {
+		t.Errorf("Release failed: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Package idempotency keeps the outcome of requests sent with an
+// Idempotency-Key so that retries of the same request can be answered with
+// the original response instead of being carried out again.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrClaimLost is returned by Complete and Release when the caller's claim
+// on a key has expired and the key may since have been claimed again
+var ErrClaimLost = errors.New("idempotency key is no longer held by this request")
+
+// Response is a stored response, replayed verbatim to retries
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Record is the state of an idempotency key. Response is nil while the
+// request that claimed the key is still being handled.
+type Record struct {
+	Key         string
+	RequestHash string
+	Response    *Response
+	ExpiresAt   time.Time
+}
+
+// Store persists idempotency records. Implementations must be safe for
+// concurrent use, and Claim must be atomic so that only one of several
+// concurrent requests with the same key is carried out.
+type Store interface {
+	// Claim reserves key for a request with the given hash until expiresAt,
+	// which should be a short lease covering the request. If the key is
+	// already held by a record that has not expired, that record is returned
+	// and nothing is reserved. A nil record means the caller now holds the
+	// key under the returned token and must Complete or Release it.
+	Claim(ctx context.Context, key, requestHash string, expiresAt time.Time) (*Record, string, error)
+
+	// Complete stores the response of the request holding key under token
+	// and keeps it until expiresAt. It returns ErrClaimLost, storing
+	// nothing, if token no longer holds the key.
+	Complete(ctx context.Context, key, token string, response Response, expiresAt time.Time) error
+
+	// Release gives up a key claimed under token without storing a
+	// response, so that the request can be retried with the same key. It
+	// returns ErrClaimLost, leaving the key alone, if token no longer holds
+	// it.
+	Release(ctx context.Context, key, token string) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// NewToken returns a random token identifying a claim
+func NewToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("idempotency: failed to read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+// Package storetest is a conformance suite for idempotency.Store
+// implementations. Each store package runs it from its own tests.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ucups/go-public-api/internal/idempotency"
+)
+
+// Run runs the conformance suite, calling newStore for a fresh, empty store
+// in every subtest
+func Run(t *testing.T, newStore func(t *testing.T) idempotency.Store) {
+	t.Run("Claim", func(t *testing.T) { testClaim(t, newStore(t)) })
+	t.Run("Replay", func(t *testing.T) { testReplay(t, newStore(t)) })
+	t.Run("DifferentBody", func(t *testing.T) { testDifferentBody(t, newStore(t)) })
+	t.Run("Release", func(t *testing.T) { testRelease(t, newStore(t)) })
+	t.Run("ExpiredKeys", func(t *testing.T) { testExpiredKeys(t, newStore(t)) })
+	t.Run("OwnerFencing", func(t *testing.T) { testOwnerFencing(t, newStore(t)) })
+}
+
+const (
+	key       = "POST /public-api/users key-1"
+	hash      = "hash-1"
+	otherHash = "hash-2"
+)
+
+var (
+	lease    = time.Now().Add(time.Minute)
+	expired  = time.Now().Add(-time.Second)
+	response = idempotency.Response{StatusCode: 201, ContentType: "application/json", Body: []byte(`{"id":1}`)}
+)
+
+// mustClaim claims key and fails the test unless the claim succeeds
+func mustClaim(t *testing.T, store idempotency.Store, requestHash string, expiresAt time.Time) string {
+	t.Helper()
+	record, token, err := store.Claim(context.Background(), key, requestHash, expiresAt)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if record != nil {
+		t.Fatalf("Claim returned record %+v, want the key claimed", record)
+	}
+	if token == "" {
+		t.Fatal("Claim returned an empty token")
+	}
+	return token
+}
+
+// mustHold claims key and fails the test unless it is held by another
+// request, returning that request's record
+func mustHold(t *testing.T, store idempotency.Store, requestHash string) *idempotency.Record {
+	t.Helper()
+	record, _, err := store.Claim(context.Background(), key, requestHash, lease)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if record == nil {
+		t.Fatal("Claim succeeded, want the key held")
+	}
+	return record
+}
+
+func testClaim(t *testing.T, store idempotency.Store) {
+	mustClaim(t, store, hash, lease)
+
+	record := mustHold(t, store, hash)
+	if record.Key != key || record.RequestHash != hash {
+		t.Errorf("record = %+v, want key %q and hash %q", record, key, hash)
+	}
+	if record.Response != nil {
+		t.Errorf("in-progress record has response %+v", record.Response)
+	}
+}
+
+func testReplay(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+	token := mustClaim(t, store, hash, lease)
+	keepUntil := time.Now().Add(24 * time.Hour)
+	if err := store.Complete(ctx, key, token, response, keepUntil); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	record := mustHold(t, store, hash)
+	if record.Response == nil {
+		t.Fatal("completed record has no response")
+	}
+	if record.Response.StatusCode != response.StatusCode || record.Response.ContentType != response.ContentType || !bytes.Equal(record.Response.Body, response.Body) {
+		t.Errorf("response = %+v, want %+v", record.Response, response)
+	}
+	if record.ExpiresAt.Before(keepUntil.Add(-time.Second)) {
+		t.Errorf("record expires at %v, want the response kept until %v", record.ExpiresAt, keepUntil)
+	}
+}
+
+func testDifferentBody(t *testing.T, store idempotency.Store) {
+	mustClaim(t, store, hash, lease)
+
+	// The store reports the original hash; telling the bodies apart is up
+	// to the caller
+	if record := mustHold(t, store, otherHash); record.RequestHash != hash {
+		t.Errorf("record hash = %q, want %q", record.RequestHash, hash)
+	}
+}
+
+func testRelease(t *testing.T, store idempotency.Store) {
+	token := mustClaim(t, store, hash, lease)
+	if err := store.Release(context.Background(), key, token); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	mustClaim(t, store, otherHash, lease)
+}
+
+func testExpiredKeys(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+	token := mustClaim(t, store, hash, lease)
+	if err := store.Complete(ctx, key, token, response, expired); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	// An expired response is neither replayed nor in the way of a new claim
+	mustClaim(t, store, otherHash, lease)
+	if record := mustHold(t, store, otherHash); record.Response != nil {
+		t.Errorf("new claim has the expired response %+v", record.Response)
+	}
+}
+
+func testOwnerFencing(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+
+	// The first request outlives its lease and a retry claims the key
+	stale := mustClaim(t, store, hash, expired)
+	current := mustClaim(t, store, otherHash, lease)
+	if stale == current {
+		t.Fatal("both claims got the same token")
+	}
+
+	if err := store.Complete(ctx, key, stale, response, lease); !errors.Is(err, idempotency.ErrClaimLost) {
+		t.Errorf("Complete with a stale token = %v, want ErrClaimLost", err)
+	}
+	if err := store.Release(ctx, key, stale); !errors.Is(err, idempotency.ErrClaimLost) {
+		t.Errorf("Release with a stale token = %v, want ErrClaimLost", err)
+	}
+	record := mustHold(t, store, otherHash)
+	if record.RequestHash != otherHash || record.Response != nil {
+		t.Errorf("record = %+v, want the retry's claim untouched", record)
+	}
+
+	if err := store.Complete(ctx, key, current, response, lease); err != nil {
+		t.Errorf("Complete with the current token failed: %v", err)
+	}
+}
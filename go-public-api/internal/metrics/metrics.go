@@ -0,0 +1,115 @@
+// Package metrics defines the Prometheus metrics the public API exports on
+// /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/ucups/go-public-api/internal/cache"
+)
+
+// Metrics holds the service's collectors and the registry they are
+// exported from
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	upstreamDuration *prometheus.HistogramVec
+	upstreamErrors   *prometheus.CounterVec
+}
+
+// New creates the service's metrics in a registry of their own, together
+// with the standard Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by method, route and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "upstream_request_duration_seconds",
+			Help:    "Time taken by calls to upstream services, by client, method and status code (\"error\" when no response arrived).",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"client", "method", "status"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "upstream_request_errors_total",
+			Help: "Calls to upstream services that failed or returned a 5xx status, by client and method.",
+		}, []string{"client", "method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.upstreamDuration,
+		m.upstreamErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a handled HTTP request. route is the route
+// template, not the request path, to keep the number of series bounded.
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.requestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveUpstream records a call made by client. status is the response
+// status code, or 0 if no response arrived; failed counts the call as an
+// error.
+func (m *Metrics) ObserveUpstream(client, method string, status int, duration time.Duration, failed bool) {
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	m.upstreamDuration.WithLabelValues(client, method, code).Observe(duration.Seconds())
+	if failed {
+		m.upstreamErrors.WithLabelValues(client, method).Inc()
+	}
+}
+
+// RegisterCache exports the usage of the cache named name, read from stats
+// whenever the metrics are collected
+func (m *Metrics) RegisterCache(name string, stats func() cache.Stats) {
+	labels := prometheus.Labels{"cache": name}
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "cache_hits_total",
+			Help:        "Lookups answered from the cache.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "cache_misses_total",
+			Help:        "Lookups not answered from the cache: the key was absent or expired, or its value could not be used, such as a deleted user.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Misses) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "cache_evictions_total",
+			Help:        "Entries evicted to make room for new ones.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Evictions) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "cache_entries",
+			Help:        "Entries currently held in the cache.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Entries) }),
+	)
+}
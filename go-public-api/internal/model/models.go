@@ -2,10 +2,35 @@ package model
 
 // User represents user data from user service
 type User struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
-	CreatedAt int64  `json:"created_at"`
-	UpdatedAt int64  `json:"updated_at"`
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Email     *string `json:"email,omitempty"`
+	Phone     *string `json:"phone,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+	UpdatedAt int64   `json:"updated_at"`
+	DeletedAt *int64  `json:"deleted_at,omitempty"`
+}
+
+// DeletedUserName is shown in place of the name of a deleted user
+const DeletedUserName = "Deleted user"
+
+// Tombstone returns a placeholder for a deleted user that keeps only its ID
+// and deletion time. Contact details are dropped along with the name.
+func (u User) Tombstone() User {
+	return User{
+		ID:        u.ID,
+		Name:      DeletedUserName,
+		DeletedAt: u.DeletedAt,
+	}
+}
+
+// UserPage is one page of users from user service. Total is nil when
+// counting was skipped. NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []User
+	NextCursor string
+	Total      *int64
+	HasMore    bool
 }
 
 // Listing represents listing data from listing service
@@ -18,19 +43,49 @@ type Listing struct {
 	UpdatedAt   int64  `json:"updated_at"`
 }
 
-// EnrichedListing represents a listing with embedded user information
+// ListingPage is one page of listings from listing service. Total is nil
+// when counting was skipped.
+type ListingPage struct {
+	Listings   []Listing `json:"listings"`
+	NextCursor string    `json:"next_cursor"`
+	HasMore    bool      `json:"has_more"`
+	Total      *int64    `json:"total"`
+}
+
+// EnrichedListing represents a listing with embedded user information.
+// User is nil when the owner could not be looked up.
 type EnrichedListing struct {
 	ID          int64  `json:"id"`
 	ListingType string `json:"listing_type"`
 	Price       int64  `json:"price"`
 	CreatedAt   int64  `json:"created_at"`
 	UpdatedAt   int64  `json:"updated_at"`
-	User        User   `json:"user"`
+	User        *User  `json:"user"`
 }
 
-// CreateUserRequest represents the request to create a user
+// EnrichmentWarning reports a listing whose owner could not be looked up,
+// with the problem code and detail of the failure
+type EnrichmentWarning struct {
+	ListingID int64  `json:"listing_id"`
+	UserID    int64  `json:"user_id"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail"`
+}
+
+// CreateUserRequest represents the request to create a user. Email and
+// Phone are optional.
 type CreateUserRequest struct {
-	Name string `json:"name"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// UpdateUserRequest represents the request to update a user. UpdatedAt is
+// the version the client last saw and may be omitted when an If-Match
+// header is sent instead.
+type UpdateUserRequest struct {
+	Name      *string `json:"name"`
+	UpdatedAt *int64  `json:"updated_at"`
 }
 
 // CreateListingRequest represents the request to create a listing
@@ -39,10 +94,3 @@ type CreateListingRequest struct {
 	ListingType string `json:"listing_type"`
 	Price       int64  `json:"price"`
 }
-
-// ServiceResponse represents a generic service response
-type ServiceResponse struct {
-	Result bool                   `json:"result"`
-	Data   map[string]interface{} `json:"data,omitempty"`
-	Errors []string               `json:"errors,omitempty"`
-}
@@ -0,0 +1,101 @@
+// Package problem defines the error responses of the public API, which the
+// user service shares: RFC 7807 problem details extended with a stable
+// machine-readable code, per-field errors and the ID of the request that
+// failed.
+package problem
+
+import (
+	"net/http"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// typePrefix prefixes a code to form the problem type URI
+const typePrefix = "urn:problem-type:"
+
+// Codes of problems that are not specific to a domain. Codes never change
+// once published; clients match on them rather than on titles or details.
+// Problems reported by the user service keep the codes it gave them, such as
+// user_not_found or email_taken.
+const (
+	CodeValidationFailed     = "validation_failed"
+	CodeMalformedBody        = "malformed_body"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeBadRequest           = "bad_request"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeRequestCancelled     = "request_cancelled"
+	CodeInternal             = "internal_error"
+
+	// An Idempotency-Key was reused with a different body, or while the
+	// request that first used it is still running
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+
+	// An upstream service could not be reached, failed or sent a response
+	// that could not be understood, or did not answer in time. While its
+	// circuit breaker is open, calls to it are not attempted at all.
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeUpstreamError       = "upstream_error"
+	CodeUpstreamTimeout     = "upstream_timeout"
+	CodeUpstreamCircuitOpen = "upstream_circuit_open"
+)
+
+// statusClientClosedRequest is the non-standard status of a request the
+// client cancelled, which net/http has no text for
+const statusClientClosedRequest = 499
+
+// Problem is an RFC 7807 problem details object. Code identifies the problem
+// and determines Type; RequestID ties the response to the service's logs.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a problem with a single input field
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// New creates a problem with the given status, code and detail
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   TypeURI(code),
+		Title:  Title(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// TypeURI returns the problem type URI of code
+func TypeURI(code string) string {
+	return typePrefix + code
+}
+
+// Title returns the standard text of status, used as the problem title
+func Title(status int) string {
+	if status == statusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// Error implements the error interface
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ucups/go-public-api/internal/config"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupExportsSpansToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), "test-service", config.TracingConfig{
+		Exporter: config.TracingFile, File: file, SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "offline span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read spans: %v", err)
+	}
+	for _, want := range []string{"offline span", "test-service"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("exported spans missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "test-service", config.TracingConfig{Exporter: "jaeger"}); err == nil {
+		t.Error("Setup() error = nil, want an unknown exporter error")
+	}
+}
@@ -1,60 +1,260 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/ucups/go-user-service/internal/config"
 	"github.com/ucups/go-user-service/internal/handler"
+	"github.com/ucups/go-user-service/internal/logging"
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/migrate"
+	"github.com/ucups/go-user-service/internal/repository"
+	"github.com/ucups/go-user-service/internal/repository/instrumented"
+	"github.com/ucups/go-user-service/internal/repository/memory"
+	"github.com/ucups/go-user-service/internal/repository/postgres"
 	"github.com/ucups/go-user-service/internal/repository/sqlite"
+	"github.com/ucups/go-user-service/internal/tracing"
 	"github.com/ucups/go-user-service/internal/usecase"
 )
 
 func main() {
+	// Log JSON lines from the start; the level is set once debug is known
+	slog.SetDefault(logging.New(os.Stderr, false))
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("failed to load configuration", "error", err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg.Server.Debug))
+
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("failed to print configuration", "error", err)
+		}
+		return
+	}
+
+	// "user-service [flags] migrate ..." manages the schema instead of serving
+	if len(cfg.Args) > 0 {
+		if cfg.Args[0] != "migrate" {
+			fatal("unknown command", "command", cfg.Args[0], "usage", migrateUsage)
+		}
+		if err := runMigrate(cfg.DB, cfg.Args[1:]); err != nil {
+			fatal("migration failed", "error", err)
+		}
+		return
+	}
+
+	// Initialize tracing before anything that creates spans
+	shutdownTracing, err := tracing.Setup(context.Background(), "user-service", cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("failed to initialize tracing", "error", err)
 	}
 
-	// Initialize repository layer
-	repo, err := sqlite.NewUserRepository(cfg.DB.Path)
+	// Initialize repository layer, tracing and timing every call
+	m := metrics.New()
+	store, err := newUserRepository(cfg.DB)
 	if err != nil {
-		log.Fatalf("Failed to initialize repository: %v", err)
+		fatal("failed to initialize repository", "error", err)
 	}
-	defer repo.Close()
+	repo := instrumented.NewUserRepository(store, cfg.DB.Driver, m)
 
 	// Initialize use case layer (dependency injection)
 	userUseCase := usecase.NewUserUseCase(repo)
 
 	// Setup routes
-	mux := handler.SetupRoutes(userUseCase)
+	readiness := handler.NewReadiness()
+	mux := handler.SetupRoutes(userUseCase, readiness, m)
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	if cfg.Server.Debug {
-		log.Printf("Starting user service in DEBUG mode on %s", addr)
-		log.Printf("Database path: %s", cfg.DB.Path)
-		log.Printf("Listing Service URL: %s", cfg.Services.ListingServiceURL)
-	} else {
-		log.Printf("Starting user service on %s", addr)
+	slog.Info("starting user service", "addr", addr, "debug", cfg.Server.Debug)
+	slog.Debug("configuration",
+		"db_driver", cfg.DB.Driver,
+		"db_path", cfg.DB.Path,
+		"listing_service", cfg.Services.ListingServiceURL,
+		"tracing_exporter", cfg.Tracing.Exporter,
+	)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal("failed to listen", "addr", addr, "error", err)
 	}
 
-	// Graceful shutdown
+	// Shut down on SIGINT or SIGTERM; a second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	srv := &http.Server{Handler: mux}
+	serveErr := serve(ctx, srv, ln, readiness, cfg.Server)
+
+	// Handlers cut off by a drain timeout may still be using the repository,
+	// so it is left for the process exit to release
+	if errors.Is(serveErr, errDrainTimeout) {
+		slog.Warn("leaving repository open for requests still in flight")
+	} else if err := repo.Close(); err != nil {
+		slog.Error("failed to close repository", "error", err)
+	}
+	if err := flushTraces(shutdownTracing); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	if serveErr != nil {
+		fatal("server stopped with an error", "error", serveErr)
+	}
+}
+
+// errDrainTimeout is returned by serve when in-flight requests outlast the
+// drain timeout. Their handlers are not stopped by closing the server and
+// may still be running.
+var errDrainTimeout = errors.New("in-flight requests did not finish before the drain timeout")
+
+// serve runs srv on ln until ctx is done and then shuts it down gracefully.
+// Readiness fails first, and after cfg.ReadinessDelay the listener closes
+// and in-flight requests get up to cfg.DrainTimeout to finish. Connections
+// still open after that are closed and errDrainTimeout is returned.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, readiness *handler.Readiness, cfg config.ServerConfig) error {
+	serverErr := make(chan error, 1)
 	go func() {
-		if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
-		}
+		serverErr <- srv.Serve(ln)
 	}()
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+	readiness.StartDraining()
+	time.Sleep(cfg.ReadinessDelay)
+
+	slog.Info("draining in-flight requests", "timeout", cfg.DrainTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		srv.Close()
+		return errDrainTimeout
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// traceFlushTimeout bounds how long shutdown waits for buffered spans to be
+// exported
+const traceFlushTimeout = 5 * time.Second
+
+// flushTraces exports buffered spans and closes the trace exporter
+func flushTraces(shutdown func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancel()
+	return shutdown(ctx)
+}
+
+// fatal logs msg as an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newUserRepository creates the repository backend selected by cfg.Driver
+func newUserRepository(cfg config.DBConfig) (repository.UserRepository, error) {
+	switch cfg.Driver {
+	case config.DriverSQLite:
+		return sqlite.NewUserRepository(cfg.Path)
+	case config.DriverPostgres:
+		return postgres.NewUserRepository(cfg.DSN)
+	case config.DriverMemory:
+		return memory.NewUserRepository(), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+}
+
+const migrateUsage = "usage: user-service [flags] migrate up | down [steps] | status"
+
+// runMigrate implements the migrate subcommand against the configured database
+func runMigrate(cfg config.DBConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+	var db *sql.DB
+	var migrator *migrate.Migrator
+	var err error
+	switch cfg.Driver {
+	case config.DriverSQLite:
+		db, migrator, err = sqlite.OpenDB(ctx, cfg.Path)
+	case config.DriverPostgres:
+		db, migrator, err = postgres.OpenDB(ctx, cfg.DSN)
+	default:
+		return fmt.Errorf("database driver %q has no schema to migrate", cfg.Driver)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No migrations to roll back")
+		}
+		for _, m := range rolledBack {
+			fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + time.UnixMicro(s.AppliedAt).UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
 
-	log.Println("Shutting down server...")
+	return nil
 }
@@ -1,11 +1,8 @@
 package config
 
 import (
-	"log"
-	"os"
-	"strconv"
-
-	"github.com/joho/godotenv"
+	"fmt"
+	"time"
 )
 
 // Config holds all configuration for the application
@@ -13,62 +10,144 @@ type Config struct {
 	Server   ServerConfig
 	DB       DBConfig
 	Services ServicesConfig
+	Tracing  TracingConfig
+
+	// PrintConfig is set by --print-config: print the configuration and exit
+	PrintConfig bool
+	// Args holds the command-line arguments left after the flags
+	Args []string
+
+	// resolved records the effective value of every setting and its source
+	resolved []resolved
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Port  int
-	Debug bool
+	Port           int
+	Debug          bool
+	DrainTimeout   time.Duration // How long shutdown waits for in-flight requests
+	ReadinessDelay time.Duration // How long readiness fails before draining starts
 }
 
 // DBConfig holds database configuration
 type DBConfig struct {
-	Path string
+	Driver string // Repository backend: "sqlite", "postgres" or "memory"
+	Path   string // SQLite database file, used by the sqlite driver
+	DSN    string // PostgreSQL connection string, used by the postgres driver
 }
 
+// Supported values for DBConfig.Driver
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory" // Non-persistent, for demos and tests
+)
+
 // ServicesConfig holds external service URLs
 type ServicesConfig struct {
 	ListingServiceURL string
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
-	}
+// TracingConfig holds OpenTelemetry tracing settings
+type TracingConfig struct {
+	Exporter     string  // Where spans go: "none", "stdout", "file" or "otlp"
+	File         string  // File spans are appended to by the file exporter
+	OTLPEndpoint string  // URL spans are sent to by the otlp exporter
+	SampleRatio  float64 // Fraction of new traces recorded, from 0 to 1
+}
 
-	config := &Config{}
+// Supported values for TracingConfig.Exporter
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+	TracingOTLP   = "otlp"
+)
 
-	// Server configuration
-	portStr := os.Getenv("PORT")
-	if portStr == "" {
-		portStr = "7000" // Default port
-	}
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return nil, err
-	}
-	config.Server.Port = port
+// programName names the binary in flag usage messages
+const programName = "user-service"
 
-	debugStr := os.Getenv("DEBUG_MODE")
-	if debugStr == "" {
-		debugStr = "true" // Default debug mode
-	}
-	config.Server.Debug = debugStr == "true"
+// settings lists every configuration value with its default and the names
+// it goes by in each layer
+var settings = []setting{
+	{
+		key: "server.port", env: "PORT", flag: "port", def: "7000",
+		usage: "Server port",
+		apply: func(c *Config, v string) (err error) { c.Server.Port, err = parsePort(v); return },
+	},
+	{
+		key: "server.debug", env: "DEBUG_MODE", flag: "debug", def: "true", isBool: true,
+		usage: "Debug mode",
+		apply: func(c *Config, v string) (err error) { c.Server.Debug, err = parseBool(v); return },
+	},
+	{
+		key: "server.shutdown_drain_timeout", env: "SHUTDOWN_DRAIN_TIMEOUT", flag: "shutdown-drain-timeout", def: "30s",
+		usage: "How long shutdown waits for in-flight requests",
+		apply: func(c *Config, v string) (err error) { c.Server.DrainTimeout, err = parseDuration(v); return },
+	},
+	{
+		key: "server.shutdown_readiness_delay", env: "SHUTDOWN_READINESS_DELAY", flag: "shutdown-readiness-delay", def: "0s",
+		usage: "How long readiness fails before draining starts",
+		apply: func(c *Config, v string) (err error) { c.Server.ReadinessDelay, err = parseDuration(v); return },
+	},
+	{
+		key: "db.driver", env: "DB_DRIVER", flag: "db-driver", def: DriverSQLite,
+		usage: "Database driver: sqlite, postgres or memory",
+		apply: func(c *Config, v string) (err error) {
+			c.DB.Driver, err = parseChoice(v, DriverSQLite, DriverPostgres, DriverMemory)
+			return
+		},
+	},
+	{
+		key: "db.path", env: "DB_PATH", flag: "db-path", def: "users.db",
+		usage: "SQLite database file",
+		apply: func(c *Config, v string) error { c.DB.Path = v; return nil },
+	},
+	{
+		key: "db.dsn", env: "DB_DSN", flag: "db-dsn", secret: true,
+		usage: "PostgreSQL connection string",
+		apply: func(c *Config, v string) error { c.DB.DSN = v; return nil },
+	},
+	{
+		key: "services.listing_service_url", env: "LISTING_SERVICE_URL", flag: "listing-service", def: "http://localhost:6000",
+		usage: "Listing service URL",
+		apply: func(c *Config, v string) (err error) { c.Services.ListingServiceURL, err = parseURL(v); return },
+	},
+	{
+		key: "tracing.exporter", env: "TRACING_EXPORTER", flag: "tracing-exporter", def: TracingNone,
+		usage: "Trace exporter: none, stdout, file or otlp",
+		apply: func(c *Config, v string) (err error) {
+			c.Tracing.Exporter, err = parseChoice(v, TracingNone, TracingStdout, TracingFile, TracingOTLP)
+			return
+		},
+	},
+	{
+		key: "tracing.file", env: "TRACING_FILE", flag: "tracing-file", def: "traces.jsonl",
+		usage: "File the file trace exporter appends spans to",
+		apply: func(c *Config, v string) error { c.Tracing.File = v; return nil },
+	},
+	{
+		key: "tracing.otlp_endpoint", env: "TRACING_OTLP_ENDPOINT", flag: "tracing-otlp-endpoint", def: "http://localhost:4318/v1/traces",
+		usage: "OTLP/HTTP URL the otlp trace exporter sends spans to",
+		apply: func(c *Config, v string) (err error) { c.Tracing.OTLPEndpoint, err = parseURL(v); return },
+	},
+	{
+		key: "tracing.sample_ratio", env: "TRACING_SAMPLE_RATIO", flag: "tracing-sample-ratio", def: "1",
+		usage: "Fraction of new traces to record, from 0 to 1",
+		apply: func(c *Config, v string) (err error) { c.Tracing.SampleRatio, err = parseRatio(v); return },
+	},
+}
 
-	// Database configuration
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "users.db" // Default db path
+// validate checks rules that involve more than one setting
+func (c *Config) validate() error {
+	if c.DB.Driver == DriverPostgres && c.DB.DSN == "" {
+		return fmt.Errorf("db.dsn (DB_DSN) is required when the database driver is %q", DriverPostgres)
 	}
-	config.DB.Path = dbPath
-
-	// Services configuration
-	config.Services.ListingServiceURL = os.Getenv("LISTING_SERVICE_URL")
-	if config.Services.ListingServiceURL == "" {
-		config.Services.ListingServiceURL = "http://localhost:6000" // Default listing service URL
+	if c.DB.Driver == DriverSQLite && c.DB.Path == "" {
+		return fmt.Errorf("db.path (DB_PATH) is required when the database driver is %q", DriverSQLite)
 	}
-
-	return config, nil
+	if c.Tracing.Exporter == TracingFile && c.Tracing.File == "" {
+		return fmt.Errorf("tracing.file (TRACING_FILE) is required when the trace exporter is %q", TracingFile)
+	}
+	return nil
 }
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+// Error kinds. Use errors.Is to check which kind an error belongs to.
+var (
+	// ErrNotFound means the requested entity does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrValidation means the input failed validation
+	ErrValidation = errors.New("validation failed")
+
+	// ErrConflict means the request conflicts with the current state
+	ErrConflict = errors.New("conflict")
+)
+
+// Error is a domain error of a specific kind. Code identifies the error for
+// API clients and never changes once published. Field names the input field
+// the error concerns, if any.
+type Error struct {
+	Kind    error
+	Code    string
+	Field   string
+	Message string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the kind of the error
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Codes of field validation failures
+const (
+	CodeRequired = "required" // The field is missing or blank
+	CodeInvalid  = "invalid"  // The value is malformed
+	CodeTooLong  = "too_long" // The value exceeds its maximum length
+	CodeTooMany  = "too_many" // The list has more items than allowed
+	CodeConflict = "conflict" // The value cannot be combined with another field
+)
+
+// FieldError describes a problem with a single input field. Code is one of
+// the Code constants.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports one or more invalid input fields
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// NewValidationError creates a validation error for a single field
+func NewValidationError(field, code, message string) *ValidationError {
+	return &ValidationError{
+		Fields: []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// Add records another invalid field
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Merge records the invalid fields of err, which should be a
+// ValidationError. Any other error is recorded as an invalid value of field.
+func (e *ValidationError) Merge(field string, err error) {
+	var other *ValidationError
+	if errors.As(err, &other) {
+		e.Fields = append(e.Fields, other.Fields...)
+		return
+	}
+	e.Add(field, CodeInvalid, err.Error())
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap makes every ValidationError match ErrValidation
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
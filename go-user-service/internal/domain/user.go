@@ -1,44 +1,250 @@
 package domain
 
 import (
-	"errors"
+	"encoding/base64"
+	"fmt"
+	"net/mail"
+	"regexp"
 	"strings"
 	"time"
+	"unicode"
 )
 
-// User represents a user entity
+// User represents a user entity. Email and Phone are optional and stored
+// normalized, see NormalizeEmail and NormalizePhone.
 type User struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
-	CreatedAt int64  `json:"created_at"`
-	UpdatedAt int64  `json:"updated_at"`
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Email     *string `json:"email,omitempty"`
+	Phone     *string `json:"phone,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+	UpdatedAt int64   `json:"updated_at"`
+	DeletedAt *int64  `json:"deleted_at,omitempty"`
 }
 
-// NewUser creates a new user with validation
-func NewUser(name string) (*User, error) {
+// ErrUserNotFound is returned when a user does not exist
+var ErrUserNotFound = &Error{Kind: ErrNotFound, Code: "user_not_found", Message: "user not found"}
+
+// ErrStaleUser is returned when a user was modified after the version the
+// caller based its update on
+var ErrStaleUser = &Error{Kind: ErrConflict, Code: "stale_user", Message: "user has been modified since it was last read"}
+
+// ErrEmailTaken is returned when another user already has the email address
+var ErrEmailTaken = &Error{Kind: ErrConflict, Code: "email_taken", Field: "email", Message: "email is already in use"}
+
+// NewUser creates a new user with validation. An empty email or phone
+// leaves it unset; otherwise it is normalized. Every invalid field is
+// reported in a single ValidationError.
+func NewUser(name, email, phone string) (*User, error) {
+	user := &User{Name: name}
+	invalid := &ValidationError{}
+
+	if err := ValidateName(name); err != nil {
+		invalid.Merge("name", err)
+	}
+
+	if email != "" {
+		normalized, err := NormalizeEmail(email)
+		if err != nil {
+			invalid.Merge("email", err)
+		}
+		user.Email = &normalized
+	}
+
+	if phone != "" {
+		normalized, err := NormalizePhone(phone)
+		if err != nil {
+			invalid.Merge("phone", err)
+		}
+		user.Phone = &normalized
+	}
+
+	if len(invalid.Fields) > 0 {
+		return nil, invalid
+	}
+
+	now := time.Now().UnixMicro()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return user, nil
+}
+
+// Rename validates and sets a new name, bumping UpdatedAt
+func (u *User) Rename(name string) error {
 	if err := ValidateName(name); err != nil {
-		return nil, err
+		return err
 	}
 
+	u.Name = name
+	u.touch()
+	return nil
+}
+
+// IsDeleted reports whether the user has been soft deleted
+func (u *User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// MarkDeleted soft deletes the user, bumping UpdatedAt
+func (u *User) MarkDeleted() {
+	u.touch()
+	deletedAt := u.UpdatedAt
+	u.DeletedAt = &deletedAt
+}
+
+// Restore undoes a soft delete, bumping UpdatedAt
+func (u *User) Restore() {
+	u.touch()
+	u.DeletedAt = nil
+}
+
+// touch bumps UpdatedAt. UpdatedAt always moves forward so that every change
+// yields a new version.
+func (u *User) touch() {
 	now := time.Now().UnixMicro()
-	return &User{
-		Name:      name,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+	if now <= u.UpdatedAt {
+		now = u.UpdatedAt + 1
+	}
+	u.UpdatedAt = now
 }
 
 // ValidateName validates the user name
 func ValidateName(name string) error {
 	name = strings.TrimSpace(name)
 	if name == "" {
-		return errors.New("name is required")
+		return NewValidationError("name", CodeRequired, "name is required")
 	}
 	return nil
 }
 
-// UserFilter represents filter options for querying users
+// maxEmailLength is the longest address that fits in an SMTP path
+const maxEmailLength = 254
+
+// NormalizeEmail trims and lowercases an email address and checks that it
+// is a bare address such as "jane@example.com", without a display name
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > maxEmailLength {
+		return "", NewValidationError("email", CodeTooLong, fmt.Sprintf("email must be at most %d characters", maxEmailLength))
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", NewValidationError("email", CodeInvalid, "email must be a valid address such as jane@example.com")
+	}
+	return email, nil
+}
+
+// e164 matches a phone number in E.164 format: a plus sign, a country code
+// that does not start with zero and at most 15 digits in total
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// NormalizePhone removes spaces, dots, dashes and parentheses from a phone
+// number and checks that the rest is in E.164 format, such as
+// "+6591234567"
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '(', ')':
+			return -1
+		}
+		return r
+	}, phone)
+
+	if !e164.MatchString(phone) {
+		return "", NewValidationError("phone", CodeInvalid, "phone must be in E.164 format such as +6591234567")
+	}
+	return phone, nil
+}
+
+// UserFilter represents filter options for querying users. Users are listed
+// newest first, by creation time and then by ID. When After is set the page
+// starts right after that position and PageNum is ignored.
+//
+// A non-empty Query only selects users whose name has a word starting with
+// each of its SearchTerms, and ranks them by relevance before creation time.
+// Searches are paged by PageNum only.
+//
+// Limit, when set, is how many users to read from the start of the page in
+// place of PageSize, so that reading one more than PageSize tells whether
+// another page follows.
 type UserFilter struct {
-	PageNum  int
-	PageSize int
+	PageNum        int
+	PageSize       int
+	Limit          int
+	IncludeDeleted bool
+	After          *UserCursor
+	Query          string
+}
+
+// Offset returns how many users come before the page PageNum picks
+func (f UserFilter) Offset() int {
+	return (f.PageNum - 1) * f.PageSize
+}
+
+// MaxUsers returns how many users to read for the page: Limit if set,
+// otherwise PageSize
+func (f UserFilter) MaxUsers() int {
+	if f.Limit > 0 {
+		return f.Limit
+	}
+	return f.PageSize
+}
+
+// SearchTerms splits a search query, or a name, into lowercase words of
+// letters and digits. Everything else separates words.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// UserCursor is a position in the user list: the creation time and ID of
+// the last user a client has seen
+type UserCursor struct {
+	CreatedAt int64
+	ID        int64
+}
+
+// CursorAfter returns the cursor positioned at user
+func CursorAfter(user *User) *UserCursor {
+	return &UserCursor{CreatedAt: user.CreatedAt, ID: user.ID}
+}
+
+// Encode returns the cursor as an opaque, URL-safe token
+func (c UserCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.CreatedAt, c.ID)))
+}
+
+// ParseUserCursor decodes a token produced by UserCursor.Encode
+func ParseUserCursor(token string) (*UserCursor, error) {
+	invalid := NewValidationError("cursor", CodeInvalid, "invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var c UserCursor
+	if n, err := fmt.Sscanf(string(raw), "%d:%d", &c.CreatedAt, &c.ID); err != nil || n != 2 || c.ID < 1 {
+		return nil, invalid
+	}
+	if c.Encode() != token {
+		// Reject trailing garbage and non-canonical encodings
+		return nil, invalid
+	}
+	return &c, nil
+}
+
+// UserPage is one page of a user listing. NextCursor continues the listing
+// after the page and is only set when HasMore is and the listing is not a
+// search. Total counts every user matching the filter and is nil when
+// counting was skipped.
+type UserPage struct {
+	Users      []*User
+	PageNum    int // Zero when the page was read after a cursor
+	PageSize   int
+	Total      *int64
+	HasMore    bool
+	NextCursor string
 }
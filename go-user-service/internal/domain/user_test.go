@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fieldCode returns the code err reports for field, failing the test if err
+// is not a validation error
+func fieldCode(t *testing.T, err error, field string) string {
+	t.Helper()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	for _, f := range validationErr.Fields {
+		if f.Field == field {
+			return f.Code
+		}
+	}
+	t.Fatalf("err = %v, want field %s reported", err, field)
+	return ""
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+		code  string
+	}{
+		{"jane@example.com", "jane@example.com", ""},
+		{"  Jane.Doe@Example.COM\t", "jane.doe@example.com", ""},
+		{"jane+news@mail.example.co.uk", "jane+news@mail.example.co.uk", ""},
+		{"", "", CodeInvalid},
+		{"jane", "", CodeInvalid},
+		{"jane@", "", CodeInvalid},
+		{"@example.com", "", CodeInvalid},
+		{"jane@localhost", "", CodeInvalid},
+		{"jane@@example.com", "", CodeInvalid},
+		{"jane doe@example.com", "", CodeInvalid},
+		{"Jane <jane@example.com>", "", CodeInvalid},
+		{"<jane@example.com>", "", CodeInvalid},
+		{"jane@example.com, joe@example.com", "", CodeInvalid},
+		{strings.Repeat("a", maxEmailLength-len("@example.com")) + "@example.com", strings.Repeat("a", maxEmailLength-len("@example.com")) + "@example.com", ""},
+		{strings.Repeat("a", maxEmailLength) + "@example.com", "", CodeTooLong},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.email)
+		if tt.code == "" {
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, %v, want %q", tt.email, got, err, tt.want)
+			}
+			continue
+		}
+		if code := fieldCode(t, err, "email"); code != tt.code {
+			t.Errorf("NormalizeEmail(%q) code = %q, want %q", tt.email, code, tt.code)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+		ok    bool
+	}{
+		{"+6591234567", "+6591234567", true},
+		{"+65 9123 4567", "+6591234567", true},
+		{"+1 (415) 555-0123", "+14155550123", true},
+		{"+44.20.7946.0958", "+442079460958", true},
+		{"+123456789012345", "+123456789012345", true},
+		{"", "", false},
+		{"91234567", "", false},
+		{"0065 9123 4567", "", false},
+		{"+0 123 4567", "", false},
+		{"+1", "", false},
+		{"+1234567890123456", "", false},
+		{"+65 9123 4567 ext 2", "", false},
+		{"+65/91234567", "", false},
+		{"++6591234567", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.phone)
+		if tt.ok {
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizePhone(%q) = %q, %v, want %q", tt.phone, got, err, tt.want)
+			}
+			continue
+		}
+		if code := fieldCode(t, err, "phone"); code != CodeInvalid {
+			t.Errorf("NormalizePhone(%q) code = %q, want %q", tt.phone, code, CodeInvalid)
+		}
+	}
+}
+
+func TestNewUserNormalizesContactDetails(t *testing.T) {
+	user, err := NewUser("Jane", " JANE@Example.com ", "+65 9123-4567")
+	if err != nil {
+		t.Fatalf("NewUser() error = %v", err)
+	}
+	if user.Email == nil || *user.Email != "jane@example.com" {
+		t.Errorf("email = %v, want jane@example.com", user.Email)
+	}
+	if user.Phone == nil || *user.Phone != "+6591234567" {
+		t.Errorf("phone = %v, want +6591234567", user.Phone)
+	}
+
+	user, err = NewUser("Joe", "", "")
+	if err != nil || user.Email != nil || user.Phone != nil {
+		t.Errorf("NewUser without contact details = %+v, %v, want no email or phone", user, err)
+	}
+
+	_, err = NewUser(" ", "jane", "12")
+	for _, field := range []string{"name", "email", "phone"} {
+		fieldCode(t, err, field)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/logging"
+	"github.com/ucups/go-user-service/internal/problem"
+)
+
+// StatusClientClosedRequest is the non-standard status recorded when the
+// client cancels its request before a response is written
+const StatusClientClosedRequest = 499
+
+// WriteDomainError maps an error returned by the use case layer to a
+// problem response. Validation errors become 400 with one entry per invalid
+// field, missing entities 404 and conflicts 409. A *domain.Error keeps its
+// code, and its field if it names one. A cancelled request becomes 499 and a
+// request that ran out of time 504. Anything else is an internal error: it
+// is logged with the request's logger and reported as 500 without its
+// details.
+func WriteDomainError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *domain.ValidationError
+	var p *problem.Problem
+	switch {
+	case errors.As(err, &validationErr):
+		p = problem.New(http.StatusBadRequest, problem.CodeValidationFailed, validationErr.Error())
+		p.Errors = make([]problem.FieldError, len(validationErr.Fields))
+		for i, field := range validationErr.Fields {
+			p.Errors[i] = problem.FieldError{Field: field.Field, Code: field.Code, Message: field.Message}
+		}
+	case errors.Is(err, domain.ErrValidation):
+		p = domainProblem(err, http.StatusBadRequest, problem.CodeValidationFailed)
+	case errors.Is(err, domain.ErrNotFound):
+		p = domainProblem(err, http.StatusNotFound, problem.CodeNotFound)
+	case errors.Is(err, domain.ErrConflict):
+		p = domainProblem(err, http.StatusConflict, problem.CodeConflict)
+	case errors.Is(err, context.Canceled):
+		p = problem.New(StatusClientClosedRequest, problem.CodeRequestCancelled, "request cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		p = problem.New(http.StatusGatewayTimeout, problem.CodeTimeout, "request timed out")
+	default:
+		logging.FromContext(r.Context()).Error("internal error", "error", err)
+		p = problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+	}
+	WriteProblem(w, r, p)
+}
+
+// domainProblem builds the problem for an error of a domain kind, using the
+// code, field and message of a *domain.Error and falling back to code and
+// the error text otherwise
+func domainProblem(err error, status int, code string) *problem.Problem {
+	var domainErr *domain.Error
+	if !errors.As(err, &domainErr) {
+		return problem.New(status, code, err.Error())
+	}
+	if domainErr.Code != "" {
+		code = domainErr.Code
+	}
+	p := problem.New(status, code, domainErr.Message)
+	if domainErr.Field != "" {
+		p.Errors = []problem.FieldError{{Field: domainErr.Field, Code: code, Message: domainErr.Message}}
+	}
+	return p
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/problem"
+	"github.com/ucups/go-user-service/internal/repository"
+	"github.com/ucups/go-user-service/internal/repository/memory"
+	"github.com/ucups/go-user-service/internal/usecase"
+)
+
+func TestWriteDomainErrorMapsStatus(t *testing.T) {
+	captureLogs(t)
+	invalid := domain.NewValidationError("name", domain.CodeRequired, "name is required")
+	invalid.Add("email", domain.CodeInvalid, "email must be a valid address")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		fields []problem.FieldError
+		detail string
+	}{
+		{
+			name: "validation", err: fmt.Errorf("failed to create user: %w", invalid),
+			status: http.StatusBadRequest, code: problem.CodeValidationFailed,
+			fields: []problem.FieldError{
+				{Field: "name", Code: domain.CodeRequired, Message: "name is required"},
+				{Field: "email", Code: domain.CodeInvalid, Message: "email must be a valid address"},
+			},
+		},
+		{
+			name: "validation kind", err: fmt.Errorf("bad input: %w", domain.ErrValidation),
+			status: http.StatusBadRequest, code: problem.CodeValidationFailed,
+		},
+		{
+			name: "user not found", err: fmt.Errorf("failed to get user: %w", domain.ErrUserNotFound),
+			status: http.StatusNotFound, code: "user_not_found", detail: "user not found",
+		},
+		{
+			name: "not found kind", err: fmt.Errorf("no such thing: %w", domain.ErrNotFound),
+			status: http.StatusNotFound, code: problem.CodeNotFound,
+		},
+		{
+			name: "stale user", err: fmt.Errorf("failed to update user: %w", domain.ErrStaleUser),
+			status: http.StatusConflict, code: "stale_user",
+		},
+		{
+			name: "email taken", err: fmt.Errorf("failed to create user: %w", domain.ErrEmailTaken),
+			status: http.StatusConflict, code: "email_taken",
+			fields: []problem.FieldError{{Field: "email", Code: "email_taken", Message: "email is already in use"}},
+		},
+		{
+			name: "cancelled", err: fmt.Errorf("failed to get user: %w", context.Canceled),
+			status: StatusClientClosedRequest, code: problem.CodeRequestCancelled,
+		},
+		{
+			name: "deadline", err: fmt.Errorf("failed to get user: %w", context.DeadlineExceeded),
+			status: http.StatusGatewayTimeout, code: problem.CodeTimeout,
+		},
+		{
+			name: "internal", err: errors.New("database is locked"),
+			status: http.StatusInternalServerError, code: problem.CodeInternal, detail: "internal server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteDomainError(rec, httptest.NewRequest(http.MethodGet, "/users/1", nil), tt.err)
+
+			p := decodeProblem(t, rec, tt.status, tt.code)
+			if p.Status != tt.status {
+				t.Errorf("problem status = %d, want %d", p.Status, tt.status)
+			}
+			if tt.detail != "" && p.Detail != tt.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.detail)
+			}
+			if len(p.Errors) != len(tt.fields) {
+				t.Fatalf("errors = %+v, want %+v", p.Errors, tt.fields)
+			}
+			for i := range tt.fields {
+				if p.Errors[i] != tt.fields[i] {
+					t.Errorf("errors[%d] = %+v, want %+v", i, p.Errors[i], tt.fields[i])
+				}
+			}
+		})
+	}
+}
+
+// stubRepository is an in-memory repository whose GetByID is replaced by
+// getByID
+type stubRepository struct {
+	repository.UserRepository
+	getByID func(ctx context.Context, id int64) (*domain.User, error)
+}
+
+func (r *stubRepository) GetByID(ctx context.Context, id int64, includeDeleted bool) (*domain.User, error) {
+	return r.getByID(ctx, id)
+}
+
+// newStubRouter returns the service's routes backed by a stub repository
+// whose GetByID is getByID
+func newStubRouter(getByID func(ctx context.Context, id int64) (*domain.User, error)) http.Handler {
+	repo := &stubRepository{UserRepository: memory.NewUserRepository(), getByID: getByID}
+	return SetupRoutes(usecase.NewUserUseCase(repo), NewReadiness(), metrics.New())
+}
+
+func TestGetUserReportsRepositoryFailureAsInternalError(t *testing.T) {
+	captureLogs(t)
+	router := newStubRouter(func(ctx context.Context, id int64) (*domain.User, error) {
+		return nil, errors.New("database is locked")
+	})
+
+	p := decodeProblem(t, do(t, router, http.MethodGet, "/users/1", "", nil), http.StatusInternalServerError, problem.CodeInternal)
+	if p.Detail != "internal server error" {
+		t.Errorf("detail = %q, want the cause hidden", p.Detail)
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/repository/instrumented"
+	"github.com/ucups/go-user-service/internal/repository/memory"
+	"github.com/ucups/go-user-service/internal/usecase"
+)
+
+func TestMetricsReportRequestsAndQueries(t *testing.T) {
+	captureLogs(t)
+	m := metrics.New()
+	repo := instrumented.NewUserRepository(memory.NewUserRepository(), "memory", m)
+	router := SetupRoutes(usecase.NewUserUseCase(repo), NewReadiness(), m)
+
+	do(t, router, http.MethodGet, "/users/1", "", nil)
+	do(t, router, http.MethodGet, "/users/2", "", nil)
+	do(t, router, http.MethodPost, "/users", `{"name": "Jane"}`, nil)
+
+	rec := do(t, router, http.MethodGet, "/metrics", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		// Requests are counted by route template, not path
+		`http_requests_total{method="GET",route="/users/{id}",status="404"} 2`,
+		`http_requests_total{method="POST",route="/users",status="200"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/{id}",status="404"} 2`,
+		`http_request_duration_seconds_bucket{method="POST",route="/users",status="200",le="+Inf"} 1`,
+		`user_repository_query_duration_seconds_count{driver="memory",operation="get_by_id"} 2`,
+		`user_repository_query_duration_seconds_count{driver="memory",operation="create"} 1`,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+	// A user that isn't found is an answer, not a failed query
+	if strings.Contains(string(body), "user_repository_query_errors_total{") {
+		t.Errorf("metrics report query errors:\n%s", body)
+	}
+}
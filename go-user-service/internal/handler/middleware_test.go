@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/logging"
+	"github.com/ucups/go-user-service/internal/problem"
+)
+
+// captureLogs sends the default logger's output to the returned buffer for
+// the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, false))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logLines decodes the JSON log lines in buf
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestRequestLoggingAssignsRequestID(t *testing.T) {
+	captureLogs(t)
+	router := newTestRouter()
+
+	tests := []struct {
+		name  string
+		sent  string
+		adopt bool
+	}{
+		{"valid id adopted", "req-42.a_b", true},
+		{"missing id generated", "", false},
+		{"unsafe id replaced", "bad id\n", false},
+		{"overlong id replaced", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.sent != "" {
+				header.Set(logging.RequestIDHeader, tt.sent)
+			}
+			rec := do(t, router, http.MethodGet, "/users/1", "", header)
+
+			got := rec.Header().Get(logging.RequestIDHeader)
+			if tt.adopt && got != tt.sent {
+				t.Errorf("request ID = %q, want %q", got, tt.sent)
+			}
+			if !tt.adopt && (got == tt.sent || !logging.ValidRequestID(got)) {
+				t.Errorf("request ID = %q, want a new valid ID", got)
+			}
+
+			// Problems carry the ID too, so clients can quote it
+			p := decodeProblem(t, rec, http.StatusNotFound, "user_not_found")
+			if p.RequestID != got {
+				t.Errorf("problem request_id = %q, want %q", p.RequestID, got)
+			}
+		})
+	}
+}
+
+func TestRequestLoggingWritesOneJSONLinePerRequest(t *testing.T) {
+	logs := captureLogs(t)
+	router := newTestRouter()
+
+	header := http.Header{}
+	header.Set(logging.RequestIDHeader, "req-1")
+	do(t, router, http.MethodGet, "/users/7", "", header)
+
+	lines := logLines(t, logs)
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1: %s", len(lines), logs)
+	}
+	line := lines[0]
+	want := map[string]interface{}{
+		"level":      "INFO",
+		"msg":        "request",
+		"request_id": "req-1",
+		"route":      "/users/{id}",
+		"method":     "GET",
+		"path":       "/users/7",
+		"status":     float64(http.StatusNotFound),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+	if latency, ok := line["latency_ms"].(float64); !ok || latency < 0 {
+		t.Errorf("latency_ms = %v, want a duration", line["latency_ms"])
+	}
+}
+
+func TestHandlerLogsCarryRequestFields(t *testing.T) {
+	logs := captureLogs(t)
+	router := newStubRouter(func(ctx context.Context, id int64) (*domain.User, error) {
+		return nil, errors.New("database is locked")
+	})
+
+	header := http.Header{}
+	header.Set(logging.RequestIDHeader, "req-2")
+	decodeProblem(t, do(t, router, http.MethodGet, "/users/1", "", header), http.StatusInternalServerError, problem.CodeInternal)
+
+	lines := logLines(t, logs)
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want the error and the request: %s", len(lines), logs)
+	}
+	for _, line := range lines {
+		if line["level"] != "ERROR" || line["request_id"] != "req-2" || line["route"] != "/users/{id}" {
+			t.Errorf("log line %v, want an error with request_id req-2 and route /users/{id}", line)
+		}
+	}
+	if lines[0]["msg"] != "internal error" || !strings.Contains(lines[0]["error"].(string), "database is locked") {
+		t.Errorf("first line = %v, want the internal error with its cause", lines[0])
+	}
+}
+
+func TestUnmatchedRoutesAreLogged(t *testing.T) {
+	logs := captureLogs(t)
+	do(t, newTestRouter(), http.MethodGet, "/nowhere", "", nil)
+
+	lines := logLines(t, logs)
+	if len(lines) != 1 || lines[0]["route"] != unmatchedRoute || lines[0]["status"] != float64(http.StatusNotFound) {
+		t.Errorf("log = %v, want one line for the unmatched route", lines)
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Pagination describes where a page sits in a listing
+type Pagination struct {
+	PageNum  *int    `json:"page_num"` // Null when paging by cursor
+	PageSize int     `json:"page_size"`
+	Total    *int64  `json:"total"` // Null when the count was skipped
+	HasMore  bool    `json:"has_more"`
+	Next     *string `json:"next"`
+	Prev     *string `json:"prev"`
+}
+
+// setPageLinks fills in the next and prev links of p for the page requested
+// by r. Links keep every other query parameter of r. Numbered pages link to
+// the neighbouring page numbers; cursor pages only link forward, to
+// nextCursor.
+func (p *Pagination) setPageLinks(r *http.Request, nextCursor string) {
+	link := func(param, value string) *string {
+		query := r.URL.Query()
+		query.Del("page_num")
+		query.Del("cursor")
+		query.Set(param, value)
+		u := r.URL.Path + "?" + query.Encode()
+		return &u
+	}
+
+	if p.PageNum == nil {
+		if p.HasMore && nextCursor != "" {
+			p.Next = link("cursor", nextCursor)
+		}
+		return
+	}
+
+	if p.HasMore {
+		p.Next = link("page_num", strconv.Itoa(*p.PageNum+1))
+	}
+	if *p.PageNum > 1 {
+		p.Prev = link("page_num", strconv.Itoa(*p.PageNum-1))
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Readiness tracks whether the service should receive new traffic. It is
+// ready from creation until shutdown begins, so load balancers stop routing
+// to the instance before its in-flight requests are drained.
+type Readiness struct {
+	draining atomic.Bool
+}
+
+// NewReadiness creates a Readiness that reports ready
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// StartDraining makes the readiness check fail from now on
+func (r *Readiness) StartDraining() {
+	r.draining.Store(true)
+}
+
+// Ready handles GET /users/ready. It responds 200 while the service accepts
+// traffic and 503 once it is shutting down.
+func (r *Readiness) Ready(w http.ResponseWriter, req *http.Request) {
+	if r.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("shutting down"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ready"))
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/problem"
+)
+
+// maxBodyBytes is the largest request body the service reads
+const maxBodyBytes = 1 << 20
+
+// Supported request body encodings
+const (
+	contentTypeJSON = "application/json"
+	contentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// fieldCodeUnknown is the code of a body field the endpoint does not accept
+const fieldCodeUnknown = "unknown"
+
+// bodyError describes why a request body was rejected and the status and
+// problem code to respond with. Field and FieldCode are set when a single
+// field is at fault.
+type bodyError struct {
+	Status    int
+	Code      string
+	Field     string
+	FieldCode string
+	Message   string
+}
+
+// write sends the error as the response
+func (e *bodyError) write(w http.ResponseWriter, r *http.Request) {
+	p := problem.New(e.Status, e.Code, e.Message)
+	if e.Field != "" {
+		p.Errors = []problem.FieldError{{Field: e.Field, Code: e.FieldCode, Message: e.Message}}
+	}
+	WriteProblem(w, r, p)
+}
+
+// bodyRequest is a request body. Besides being decoded from JSON by
+// encoding/json, it reads itself from a URL-encoded form.
+type bodyRequest interface {
+	decodeForm(form url.Values) *bodyError
+}
+
+// decodeBody reads the request body into dst. The encoding is chosen by the
+// Content-Type header: JSON objects and URL-encoded forms are accepted,
+// anything else is rejected with 415. Fields that dst does not accept are
+// rejected, as are bodies larger than maxBodyBytes. Fields missing from the
+// body, or null in JSON, are left as they are. A request without a body and
+// without a Content-Type decodes to nothing.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst bodyRequest) *bodyError {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" && r.ContentLength == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != contentTypeJSON && mediaType != contentTypeForm) {
+		return &bodyError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    problem.CodeUnsupportedMediaType,
+			Message: fmt.Sprintf("unsupported content type %q, use %s or %s", contentType, contentTypeJSON, contentTypeForm),
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if mediaType == contentTypeJSON {
+		return decodeJSONBody(r.Body, dst)
+	}
+	if err := r.ParseForm(); err != nil {
+		return readError(err, "invalid form data")
+	}
+	return dst.decodeForm(r.PostForm)
+}
+
+// decodeJSONBody decodes a single JSON object into dst
+func decodeJSONBody(body io.Reader, dst interface{}) *bodyError {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return readError(err, "invalid JSON body")
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return readError(io.EOF, "")
+	}
+	if raw[0] != '{' {
+		return &bodyError{Status: http.StatusBadRequest, Code: problem.CodeMalformedBody, Message: "request body must be a JSON object"}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		// encoding/json has no error type for unknown fields
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return unknownField(strings.Trim(name, `"`))
+		}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			kind := "a string"
+			if typeErr.Type.Kind() == reflect.Int64 {
+				kind = "an integer"
+			}
+			return invalidField(typeErr.Field, kind)
+		}
+		return &bodyError{Status: http.StatusBadRequest, Code: problem.CodeMalformedBody, Message: "invalid JSON body"}
+	}
+	if decoder.More() {
+		return &bodyError{Status: http.StatusBadRequest, Code: problem.CodeMalformedBody, Message: "request body must contain a single JSON object"}
+	}
+	return nil
+}
+
+// decodeFormFields calls decode for every field of form, in name order so
+// that the first offending field is reported consistently. decode returns
+// an error for a field it does not accept or cannot parse.
+func decodeFormFields(form url.Values, decode func(name, value string) *bodyError) *bodyError {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := decode(name, form.Get(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readError reports a body that could not be read, distinguishing bodies
+// over the size limit from malformed ones
+func readError(err error, message string) *bodyError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &bodyError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    problem.CodeBodyTooLarge,
+			Message: fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit),
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		return &bodyError{Status: http.StatusBadRequest, Code: problem.CodeMalformedBody, Message: "request body is empty"}
+	}
+	return &bodyError{Status: http.StatusBadRequest, Code: problem.CodeMalformedBody, Message: message}
+}
+
+// unknownField reports a body field the endpoint does not accept
+func unknownField(name string) *bodyError {
+	return &bodyError{
+		Status:    http.StatusBadRequest,
+		Code:      problem.CodeValidationFailed,
+		Field:     name,
+		FieldCode: fieldCodeUnknown,
+		Message:   "unknown field",
+	}
+}
+
+// invalidField reports a body field whose value is not of kind, such as
+// "an integer"
+func invalidField(name, kind string) *bodyError {
+	return &bodyError{
+		Status:    http.StatusBadRequest,
+		Code:      problem.CodeValidationFailed,
+		Field:     name,
+		FieldCode: domain.CodeInvalid,
+		Message:   name + " must be " + kind,
+	}
+}
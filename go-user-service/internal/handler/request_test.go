@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/problem"
+)
+
+// decodeUpdate decodes body, sent with contentType, into an update request
+func decodeUpdate(contentType, body string) (updateUserRequest, *bodyError) {
+	req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	var dst updateUserRequest
+	return dst, decodeBody(httptest.NewRecorder(), req, &dst)
+}
+
+func TestDecodeBodyReadsJSONAndForms(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `{"name":"Ada","updated_at":42}`},
+		{"json with charset", "application/json; charset=utf-8", ` {"name":"Ada","updated_at":42} `},
+		{"form", contentTypeForm, "name=Ada&updated_at=42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeUpdate(tt.contentType, tt.body)
+			if err != nil {
+				t.Fatalf("decodeBody() = %+v, want nil", err)
+			}
+			if got.Name == nil || *got.Name != "Ada" || got.UpdatedAt == nil || *got.UpdatedAt != 42 {
+				t.Errorf("decoded %+v, want name Ada and updated_at 42", got)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyLeavesMissingAndNullFieldsUnset(t *testing.T) {
+	for _, body := range []string{`{}`, `{"name":null,"updated_at":null}`} {
+		got, err := decodeUpdate(contentTypeJSON, body)
+		if err != nil {
+			t.Fatalf("decodeBody(%s) = %+v, want nil", body, err)
+		}
+		if got.Name != nil || got.UpdatedAt != nil {
+			t.Errorf("decodeBody(%s) set %+v, want nothing", body, got)
+		}
+	}
+
+	got, err := decodeUpdate("", "")
+	if err != nil || got.Name != nil || got.UpdatedAt != nil {
+		t.Errorf("request without a body decoded to %+v, %+v, want nothing", got, err)
+	}
+}
+
+func TestDecodeBodyRejectsBadBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+		fieldCode   string
+		message     string
+	}{
+		{"unsupported type", "text/plain", "name=Ada", http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "", "", ""},
+		{"too large", contentTypeJSON, `{"name":"` + strings.Repeat("a", maxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "", "", ""},
+		{"empty json", contentTypeJSON, "  ", http.StatusBadRequest, problem.CodeMalformedBody, "", "", "request body is empty"},
+		{"json array", contentTypeJSON, `[{"name":"Ada"}]`, http.StatusBadRequest, problem.CodeMalformedBody, "", "", "request body must be a JSON object"},
+		{"json null", contentTypeJSON, `null`, http.StatusBadRequest, problem.CodeMalformedBody, "", "", "request body must be a JSON object"},
+		{"truncated json", contentTypeJSON, `{"name":`, http.StatusBadRequest, problem.CodeMalformedBody, "", "", "invalid JSON body"},
+		{"two json objects", contentTypeJSON, `{"name":"Ada"} {"name":"Grace"}`, http.StatusBadRequest, problem.CodeMalformedBody, "", "", "request body must contain a single JSON object"},
+		{"unknown json field", contentTypeJSON, `{"name":"Ada","email":"ada@example.com"}`, http.StatusBadRequest, problem.CodeValidationFailed, "email", fieldCodeUnknown, "unknown field"},
+		{"json number for string", contentTypeJSON, `{"name":7}`, http.StatusBadRequest, problem.CodeValidationFailed, "name", domain.CodeInvalid, "name must be a string"},
+		{"json string for integer", contentTypeJSON, `{"updated_at":"42"}`, http.StatusBadRequest, problem.CodeValidationFailed, "updated_at", domain.CodeInvalid, "updated_at must be an integer"},
+		{"json fraction for integer", contentTypeJSON, `{"updated_at":4.2}`, http.StatusBadRequest, problem.CodeValidationFailed, "updated_at", domain.CodeInvalid, "updated_at must be an integer"},
+		{"unknown form field", contentTypeForm, "name=Ada&phone=123", http.StatusBadRequest, problem.CodeValidationFailed, "phone", fieldCodeUnknown, "unknown field"},
+		{"form text for integer", contentTypeForm, "updated_at=yesterday", http.StatusBadRequest, problem.CodeValidationFailed, "updated_at", domain.CodeInvalid, "updated_at must be an integer"},
+		{"first bad form field", contentTypeForm, "zip=1&age=2", http.StatusBadRequest, problem.CodeValidationFailed, "age", fieldCodeUnknown, "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeUpdate(tt.contentType, tt.body)
+			if err == nil {
+				t.Fatal("decodeBody() = nil, want an error")
+			}
+			if err.Status != tt.status || err.Code != tt.code {
+				t.Errorf("error = %d %s, want %d %s", err.Status, err.Code, tt.status, tt.code)
+			}
+			if err.Field != tt.field || err.FieldCode != tt.fieldCode {
+				t.Errorf("field = %q (%s), want %q (%s)", err.Field, err.FieldCode, tt.field, tt.fieldCode)
+			}
+			if tt.message != "" && err.Message != tt.message {
+				t.Errorf("message = %q, want %q", err.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyReadsCreateForm(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("name=Ada&email=ada%40example.com&phone=%2B441234"))
+	req.Header.Set("Content-Type", contentTypeForm)
+	var got createUserRequest
+	if err := decodeBody(httptest.NewRecorder(), req, &got); err != nil {
+		t.Fatalf("decodeBody() = %+v, want nil", err)
+	}
+	want := createUserRequest{Name: "Ada", Email: "ada@example.com", Phone: "+441234"}
+	if got != want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
@@ -3,6 +3,10 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/logging"
+	"github.com/ucups/go-user-service/internal/problem"
 )
 
 // SuccessResponse represents a successful API response
@@ -11,12 +15,6 @@ type SuccessResponse struct {
 	Data   interface{} `json:"data,omitempty"`
 }
 
-// ErrorResponse represents an error API response
-type ErrorResponse struct {
-	Result bool     `json:"result"`
-	Errors []string `json:"errors"`
-}
-
 // WriteJSON writes a JSON response
 func WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -32,10 +30,26 @@ func WriteSuccess(w http.ResponseWriter, data interface{}) {
 	})
 }
 
-// WriteError writes an error response
-func WriteError(w http.ResponseWriter, statusCode int, errors ...string) {
-	WriteJSON(w, statusCode, ErrorResponse{
-		Result: false,
-		Errors: errors,
-	})
+// WriteProblem writes p as an application/problem+json response, tagged
+// with the request ID and path of r
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *problem.Problem) {
+	p.RequestID = logging.RequestID(r.Context())
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", problem.ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WriteError writes a problem response with the given status, code and
+// detail
+func WriteError(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	WriteProblem(w, r, problem.New(statusCode, code, detail))
+}
+
+// WriteInvalidParam writes a 400 validation problem for a single invalid
+// query or path parameter
+func WriteInvalidParam(w http.ResponseWriter, r *http.Request, param, message string) {
+	p := problem.New(http.StatusBadRequest, problem.CodeValidationFailed, message)
+	p.Errors = []problem.FieldError{{Field: param, Code: domain.CodeInvalid, Message: message}}
+	WriteProblem(w, r, p)
 }
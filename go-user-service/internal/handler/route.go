@@ -1,19 +1,44 @@
 package handler
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/problem"
 	"github.com/ucups/go-user-service/internal/usecase"
 )
 
-// SetupRoutes configures all HTTP routes
-func SetupRoutes(userUseCase *usecase.UserUseCase) *mux.Router {
+// SetupRoutes configures all HTTP routes. readiness backs the readiness
+// check, and m records request metrics and is served on /metrics.
+func SetupRoutes(userUseCase *usecase.UserUseCase, readiness *Readiness, m *metrics.Metrics) *mux.Router {
 	handler := NewUserHandler(userUseCase)
 
+	// Every request is traced, logged and measured, including those that
+	// match no route
+	observe := func(next http.Handler) http.Handler {
+		return requestTracing(requestLogging(requestMetrics(m)(next)))
+	}
+
 	router := mux.NewRouter()
+	router.Use(observe)
+	router.NotFoundHandler = observe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusNotFound, problem.CodeNotFound, "no route matches "+r.URL.Path)
+	}))
+	router.MethodNotAllowedHandler = observe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	}))
+
+	router.Handle("/metrics", m.Handler()).Methods("GET")
 
 	// User routes
 	router.HandleFunc("/users/ping", handler.Ping).Methods("GET")
+	router.HandleFunc("/users/ready", readiness.Ready).Methods("GET")
+	router.HandleFunc("/users/search", handler.SearchUsers).Methods("GET")
 	router.HandleFunc("/users/{id}", handler.GetUser).Methods("GET")
+	router.HandleFunc("/users/{id}", handler.UpdateUser).Methods("PATCH")
+	router.HandleFunc("/users/{id}", handler.DeleteUser).Methods("DELETE")
+	router.HandleFunc("/users/{id}/restore", handler.RestoreUser).Methods("POST")
 	router.HandleFunc("/users", handler.GetAllUsers).Methods("GET")
 	router.HandleFunc("/users", handler.CreateUser).Methods("POST")
 
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/repository/instrumented"
+	"github.com/ucups/go-user-service/internal/repository/memory"
+	"github.com/ucups/go-user-service/internal/usecase"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	installSpans sync.Once
+	spans        = tracetest.NewSpanRecorder()
+)
+
+// tracedSpans installs a tracer provider recording into spans. Tracers are
+// bound to the first provider installed, so the tests share one recorder
+// and tell their spans apart by trace ID.
+func tracedSpans() {
+	installSpans.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+}
+
+// spansOf returns the ended spans of the trace with the given ID, by name
+func spansOf(traceID string) map[string]sdktrace.ReadOnlySpan {
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			byName[span.Name()] = span
+		}
+	}
+	return byName
+}
+
+func TestRequestTracingContinuesCallersTrace(t *testing.T) {
+	tracedSpans()
+	logs := captureLogs(t)
+	m := metrics.New()
+	repo := instrumented.NewUserRepository(memory.NewUserRepository(), "memory", m)
+	router := SetupRoutes(usecase.NewUserUseCase(repo), NewReadiness(), m)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	header := http.Header{}
+	header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	do(t, router, http.MethodGet, "/users/1", "", header)
+
+	got := spansOf(traceID)
+	server, ok := got["GET /users/{id}"]
+	if !ok {
+		t.Fatalf("spans = %v, want a server span for GET /users/{id}", got)
+	}
+	if server.SpanKind() != trace.SpanKindServer || !server.Parent().IsRemote() || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span kind %v, parent %v, want a server span under the caller's span", server.SpanKind(), server.Parent())
+	}
+
+	// Each layer's span is a child of the one above it
+	parents := map[string]string{
+		"UserUseCase.GetUserByID": "GET /users/{id}",
+		"UserRepository.GetByID":  "UserUseCase.GetUserByID",
+	}
+	for name, parent := range parents {
+		span, ok := got[name]
+		if !ok {
+			t.Errorf("spans = %v, want %s", got, name)
+			continue
+		}
+		if span.Parent().SpanID() != got[parent].SpanContext().SpanID() {
+			t.Errorf("%s parent = %v, want %s", name, span.Parent().SpanID(), parent)
+		}
+	}
+	if lines := logLines(t, logs); lines[len(lines)-1]["trace_id"] != traceID {
+		t.Errorf("request log = %v, want trace_id %s", lines[len(lines)-1], traceID)
+	}
+	// A missing user is not an error of the server
+	if server.Status().Code == codes.Error {
+		t.Errorf("server span status = %v, want unset for a 404", server.Status())
+	}
+}
+
+func TestRequestTracingMarksServerErrors(t *testing.T) {
+	tracedSpans()
+	captureLogs(t)
+	router := newStubRouter(func(ctx context.Context, id int64) (*domain.User, error) {
+		return nil, errors.New("database is locked")
+	})
+
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	header := http.Header{}
+	header.Set("traceparent", "00-"+traceID+"-b7ad6b7169203331-01")
+	do(t, router, http.MethodGet, "/users/1", "", header)
+
+	server, ok := spansOf(traceID)["GET /users/{id}"]
+	if !ok {
+		t.Fatal("no server span for GET /users/{id}")
+	}
+	if server.Status().Code != codes.Error {
+		t.Errorf("server span status = %v, want an error for a 500", server.Status())
+	}
+}
@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/problem"
 	"github.com/ucups/go-user-service/internal/usecase"
 )
 
@@ -20,20 +26,69 @@ func NewUserHandler(userUseCase *usecase.UserUseCase) *UserHandler {
 	}
 }
 
+// createUserRequest is the body of POST /users
+type createUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+// updateUserRequest is the body of PATCH /users/{id}. UpdatedAt is the
+// version the caller last saw when no If-Match header is sent.
+type updateUserRequest struct {
+	Name      *string `json:"name"`
+	UpdatedAt *int64  `json:"updated_at"`
+}
+
+// decodeForm reads the create fields from a form
+func (req *createUserRequest) decodeForm(form url.Values) *bodyError {
+	return decodeFormFields(form, func(name, value string) *bodyError {
+		switch name {
+		case "name":
+			req.Name = value
+		case "email":
+			req.Email = value
+		case "phone":
+			req.Phone = value
+		default:
+			return unknownField(name)
+		}
+		return nil
+	})
+}
+
+// decodeForm reads the update fields from a form
+func (req *updateUserRequest) decodeForm(form url.Values) *bodyError {
+	return decodeFormFields(form, func(name, value string) *bodyError {
+		switch name {
+		case "name":
+			req.Name = &value
+		case "updated_at":
+			updatedAt, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return invalidField(name, "an integer")
+			}
+			req.UpdatedAt = &updatedAt
+		default:
+			return unknownField(name)
+		}
+		return nil
+	})
+}
+
 // CreateUser handles POST /users
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
-		WriteError(w, http.StatusBadRequest, "invalid form data")
+	// Parse JSON or form body
+	var req createUserRequest
+	if bodyErr := decodeBody(w, r, &req); bodyErr != nil {
+		bodyErr.write(w, r)
 		return
 	}
 
-	name := r.FormValue("name")
-
 	// Create user via use case
-	user, err := h.userUseCase.CreateUser(name)
+	user, err := h.userUseCase.CreateUser(r.Context(), req.Name, req.Email, req.Phone)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, err.Error())
+		WriteDomainError(w, r, err)
 		return
 	}
 
@@ -51,18 +106,115 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, "invalid user id")
+		WriteInvalidParam(w, r, "id", "invalid user id")
+		return
+	}
+
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		WriteInvalidParam(w, r, "include_deleted", err.Error())
 		return
 	}
 
 	// Get user via use case
-	user, err := h.userUseCase.GetUserByID(id)
+	user, err := h.userUseCase.GetUserByID(r.Context(), id, includeDeleted)
+	if err != nil {
+		WriteDomainError(w, r, err)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("ETag", userETag(user))
+	WriteSuccess(w, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// UpdateUser handles PATCH /users/{id}
+//
+// The caller must name the version it is updating, either with an If-Match
+// header carrying the user's ETag or with an updated_at body field. A stale
+// version is rejected with 409 Conflict.
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	// Extract ID from URL
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteInvalidParam(w, r, "id", "invalid user id")
+		return
+	}
+
+	// Parse JSON or form body
+	var req updateUserRequest
+	if bodyErr := decodeBody(w, r, &req); bodyErr != nil {
+		bodyErr.write(w, r)
+		return
+	}
+
+	// Resolve the version the caller last saw
+	var expectedUpdatedAt *int64
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if ifMatch != "*" {
+			val, err := parseETag(ifMatch)
+			if err != nil {
+				WriteInvalidParam(w, r, "If-Match", "invalid If-Match header")
+				return
+			}
+			expectedUpdatedAt = &val
+		}
+	} else if req.UpdatedAt != nil {
+		expectedUpdatedAt = req.UpdatedAt
+	} else {
+		WriteError(w, r, http.StatusPreconditionRequired, problem.CodePreconditionRequired, "If-Match header or updated_at is required")
+		return
+	}
+
+	// Update user via use case
+	user, err := h.userUseCase.UpdateUser(r.Context(), id, req.Name, expectedUpdatedAt)
+	if err != nil {
+		WriteDomainError(w, r, err)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("ETag", userETag(user))
+	WriteSuccess(w, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// DeleteUser handles DELETE /users/{id}
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.changeDeletion(w, r, h.userUseCase.DeleteUser)
+}
+
+// RestoreUser handles POST /users/{id}/restore
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	h.changeDeletion(w, r, h.userUseCase.RestoreUser)
+}
+
+// changeDeletion runs a soft delete or restore for the user in the URL
+func (h *UserHandler) changeDeletion(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id int64) (*domain.User, error)) {
+	// Extract ID from URL
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		WriteInvalidParam(w, r, "id", "invalid user id")
+		return
+	}
+
+	user, err := change(r.Context(), id)
 	if err != nil {
-		WriteError(w, http.StatusNotFound, err.Error())
+		WriteDomainError(w, r, err)
 		return
 	}
 
 	// Return success response
+	w.Header().Set("ETag", userETag(user))
 	WriteSuccess(w, map[string]interface{}{
 		"user": user,
 	})
@@ -70,6 +222,38 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 // GetAllUsers handles GET /users
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		WriteInvalidParam(w, r, "include_deleted", err.Error())
+		return
+	}
+
+	// A batch lookup by ID takes precedence over pagination
+	if idsStr := r.URL.Query().Get("ids"); idsStr != "" {
+		h.getUsersByIDs(w, r, idsStr, includeDeleted)
+		return
+	}
+
+	h.listUsers(w, r, includeDeleted, h.userUseCase.GetAllUsers)
+}
+
+// SearchUsers handles GET /users/search?q=
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	includeDeleted, err := parseIncludeDeleted(r)
+	if err != nil {
+		WriteInvalidParam(w, r, "include_deleted", err.Error())
+		return
+	}
+
+	h.listUsers(w, r, includeDeleted, h.userUseCase.SearchUsers)
+}
+
+// maxPageSize is the largest page_size applied; larger ones are capped
+const maxPageSize = 100
+
+// listUsers writes the page of users that list returns for the pagination
+// and search params of r
+func (h *UserHandler) listUsers(w http.ResponseWriter, r *http.Request, includeDeleted bool, list func(context.Context, domain.UserFilter, bool) (*domain.UserPage, error)) {
 	// Parse pagination params
 	pageNumStr := r.URL.Query().Get("page_num")
 	pageSizeStr := r.URL.Query().Get("page_size")
@@ -81,7 +265,7 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		if val, err := strconv.Atoi(pageNumStr); err == nil {
 			pageNum = val
 		} else {
-			WriteError(w, http.StatusBadRequest, "invalid page_num")
+			WriteInvalidParam(w, r, "page_num", "invalid page_num")
 			return
 		}
 	}
@@ -90,24 +274,124 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		if val, err := strconv.Atoi(pageSizeStr); err == nil {
 			pageSize = val
 		} else {
-			WriteError(w, http.StatusBadRequest, "invalid page_size")
+			WriteInvalidParam(w, r, "page_size", "invalid page_size")
 			return
 		}
 	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	filter := domain.UserFilter{
+		PageNum:        pageNum,
+		PageSize:       pageSize,
+		IncludeDeleted: includeDeleted,
+		Query:          r.URL.Query().Get("q"),
+	}
+
+	// A cursor continues a previous page and takes precedence over page_num
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		after, err := domain.ParseUserCursor(cursor)
+		if err != nil {
+			WriteDomainError(w, r, err)
+			return
+		}
+		filter.After = after
+	}
+
+	// Counting can be skipped for speed with include_total=false
+	withTotal := true
+	if includeTotalStr := r.URL.Query().Get("include_total"); includeTotalStr != "" {
+		val, err := strconv.ParseBool(includeTotalStr)
+		if err != nil {
+			WriteInvalidParam(w, r, "include_total", "invalid include_total")
+			return
+		}
+		withTotal = val
+	}
+
+	// Get users via use case
+	page, err := list(r.Context(), filter, withTotal)
+	if err != nil {
+		WriteDomainError(w, r, err)
+		return
+	}
+
+	var nextCursor interface{}
+	if page.NextCursor != "" {
+		nextCursor = page.NextCursor
+	}
+
+	pagination := Pagination{
+		PageSize: page.PageSize,
+		Total:    page.Total,
+		HasMore:  page.HasMore,
+	}
+	if page.PageNum > 0 {
+		pagination.PageNum = &page.PageNum
+	}
+	pagination.setPageLinks(r, page.NextCursor)
+
+	// Return success response
+	WriteSuccess(w, map[string]interface{}{
+		"users":       page.Users,
+		"next_cursor": nextCursor,
+		"pagination":  pagination,
+	})
+}
+
+// getUsersByIDs handles GET /users?ids=1,2,3
+func (h *UserHandler) getUsersByIDs(w http.ResponseWriter, r *http.Request, idsStr string, includeDeleted bool) {
+	parts := strings.Split(idsStr, ",")
+	ids := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			WriteInvalidParam(w, r, "ids", "invalid ids")
+			return
+		}
+		ids = append(ids, id)
+	}
 
 	// Get users via use case
-	users, err := h.userUseCase.GetAllUsers(pageNum, pageSize)
+	users, missing, err := h.userUseCase.GetUsersByIDs(r.Context(), ids, includeDeleted)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, err.Error())
+		WriteDomainError(w, r, err)
 		return
 	}
 
 	// Return success response
 	WriteSuccess(w, map[string]interface{}{
-		"users": users,
+		"users":       users,
+		"missing_ids": missing,
 	})
 }
 
+// parseIncludeDeleted reads the include_deleted query parameter
+func parseIncludeDeleted(r *http.Request) (bool, error) {
+	includeDeletedStr := r.URL.Query().Get("include_deleted")
+	if includeDeletedStr == "" {
+		return false, nil
+	}
+
+	includeDeleted, err := strconv.ParseBool(includeDeletedStr)
+	if err != nil {
+		return false, errors.New("invalid include_deleted")
+	}
+	return includeDeleted, nil
+}
+
+// userETag returns the entity tag of the user's current version
+func userETag(user *domain.User) string {
+	return `"` + strconv.FormatInt(user.UpdatedAt, 10) + `"`
+}
+
+// parseETag extracts the version from an entity tag produced by userETag
+func parseETag(etag string) (int64, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	return strconv.ParseInt(strings.Trim(etag, `"`), 10, 64)
+}
+
 // Ping handles GET /users/ping
 func (h *UserHandler) Ping(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
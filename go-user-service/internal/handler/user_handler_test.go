@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/problem"
+	"github.com/ucups/go-user-service/internal/repository/memory"
+	"github.com/ucups/go-user-service/internal/usecase"
+)
+
+// newTestRouter returns the service's routes backed by an empty in-memory
+// repository
+func newTestRouter() *mux.Router {
+	uc := usecase.NewUserUseCase(memory.NewUserRepository())
+	return SetupRoutes(uc, NewReadiness(), metrics.New())
+}
+
+// do sends a request with an optional JSON body through router
+func do(t *testing.T, router http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeData decodes the data of a success response into dst
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", rec.Code, rec.Body)
+	}
+	var envelope struct {
+		Result bool            `json:"result"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || !envelope.Result {
+		t.Fatalf("body = %s, want a result", rec.Body)
+	}
+	if err := json.Unmarshal(envelope.Data, dst); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+}
+
+// decodeProblem checks that rec is a problem with the given status and code
+// and returns it
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) problem.Problem {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if p.Code != code {
+		t.Errorf("code = %q, want %q", p.Code, code)
+	}
+	return p
+}
+
+// userResponse is the data of a single-user response
+type userResponse struct {
+	User struct {
+		ID        int64  `json:"id"`
+		Name      string `json:"name"`
+		UpdatedAt int64  `json:"updated_at"`
+	} `json:"user"`
+}
+
+// mustCreate creates a user named name through the API
+func mustCreate(t *testing.T, router http.Handler, name string) userResponse {
+	t.Helper()
+	var created userResponse
+	decodeData(t, do(t, router, http.MethodPost, "/users", `{"name":"`+name+`"}`, nil), &created)
+	return created
+}
+
+func TestCreateAndGetUser(t *testing.T) {
+	router := newTestRouter()
+	created := mustCreate(t, router, "Alice")
+	if created.User.ID == 0 || created.User.Name != "Alice" {
+		t.Fatalf("created = %+v, want Alice with an ID", created.User)
+	}
+
+	rec := do(t, router, http.MethodGet, "/users/1", "", nil)
+	var got userResponse
+	decodeData(t, rec, &got)
+	if got.User != created.User {
+		t.Errorf("got = %+v, want %+v", got.User, created.User)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Error("GET /users/1 has no ETag")
+	}
+}
+
+func TestCreateUserReportsFieldErrors(t *testing.T) {
+	router := newTestRouter()
+
+	rec := do(t, router, http.MethodPost, "/users", `{"name":"","email":"nope"}`, nil)
+	p := decodeProblem(t, rec, http.StatusBadRequest, problem.CodeValidationFailed)
+	fields := make(map[string]string)
+	for _, fieldErr := range p.Errors {
+		fields[fieldErr.Field] = fieldErr.Code
+	}
+	if fields["name"] != "required" || fields["email"] != "invalid" {
+		t.Errorf("field errors = %+v, want name required and email invalid", p.Errors)
+	}
+
+	rec = do(t, router, http.MethodPost, "/users", `{"name":"Alice","age":3}`, nil)
+	decodeProblem(t, rec, http.StatusBadRequest, problem.CodeValidationFailed)
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	router := newTestRouter()
+
+	decodeProblem(t, do(t, router, http.MethodGet, "/users/42", "", nil), http.StatusNotFound, "user_not_found")
+	decodeProblem(t, do(t, router, http.MethodGet, "/users/abc", "", nil), http.StatusBadRequest, problem.CodeValidationFailed)
+}
+
+func TestUpdateUserPreconditions(t *testing.T) {
+	router := newTestRouter()
+	mustCreate(t, router, "Alice")
+	etag := do(t, router, http.MethodGet, "/users/1", "", nil).Header().Get("ETag")
+
+	// A version is required
+	rec := do(t, router, http.MethodPatch, "/users/1", `{"name":"Alicia"}`, nil)
+	decodeProblem(t, rec, http.StatusPreconditionRequired, problem.CodePreconditionRequired)
+
+	rec = do(t, router, http.MethodPatch, "/users/1", `{"name":"Alicia"}`, http.Header{"If-Match": {etag}})
+	var updated userResponse
+	decodeData(t, rec, &updated)
+	if updated.User.Name != "Alicia" {
+		t.Errorf("name = %q, want Alicia", updated.User.Name)
+	}
+	if newETag := rec.Header().Get("ETag"); newETag == "" || newETag == etag {
+		t.Errorf("ETag after update = %q, want a new one", newETag)
+	}
+
+	// The old ETag is now stale
+	rec = do(t, router, http.MethodPatch, "/users/1", `{"name":"Ali"}`, http.Header{"If-Match": {etag}})
+	decodeProblem(t, rec, http.StatusConflict, "stale_user")
+}
+
+func TestUpdateUserWithoutChangesKeepsETag(t *testing.T) {
+	router := newTestRouter()
+	mustCreate(t, router, "Alice")
+	etag := do(t, router, http.MethodGet, "/users/1", "", nil).Header().Get("ETag")
+
+	rec := do(t, router, http.MethodPatch, "/users/1", `{}`, http.Header{"If-Match": {etag}})
+	decodeData(t, rec, &userResponse{})
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag after empty update = %q, want %q", got, etag)
+	}
+
+	// Other clients' If-Match still holds
+	rec = do(t, router, http.MethodPatch, "/users/1", `{"name":"Alicia"}`, http.Header{"If-Match": {etag}})
+	decodeData(t, rec, &userResponse{})
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	router := newTestRouter()
+	mustCreate(t, router, "Alice")
+
+	decodeData(t, do(t, router, http.MethodDelete, "/users/1", "", nil), &userResponse{})
+	decodeProblem(t, do(t, router, http.MethodGet, "/users/1", "", nil), http.StatusNotFound, "user_not_found")
+	decodeData(t, do(t, router, http.MethodGet, "/users/1?include_deleted=true", "", nil), &userResponse{})
+
+	decodeData(t, do(t, router, http.MethodPost, "/users/1/restore", "", nil), &userResponse{})
+	decodeData(t, do(t, router, http.MethodGet, "/users/1", "", nil), &userResponse{})
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	router := newTestRouter()
+	mustCreate(t, router, "Alice")
+	mustCreate(t, router, "Bob")
+
+	var batch struct {
+		Users []struct {
+			ID int64 `json:"id"`
+		} `json:"users"`
+		Missing []int64 `json:"missing_ids"`
+	}
+	decodeData(t, do(t, router, http.MethodGet, "/users?ids=2,1,9", "", nil), &batch)
+	if len(batch.Users) != 2 {
+		t.Errorf("users = %+v, want users 1 and 2", batch.Users)
+	}
+	if len(batch.Missing) != 1 || batch.Missing[0] != 9 {
+		t.Errorf("missing = %v, want [9]", batch.Missing)
+	}
+}
+
+func TestGetUsersByIDsHandlesDeletedAndBadIDs(t *testing.T) {
+	router := newTestRouter()
+	mustCreate(t, router, "Alice")
+	mustCreate(t, router, "Bob")
+	decodeData(t, do(t, router, http.MethodDelete, "/users/2", "", nil), &userResponse{})
+
+	var batch struct {
+		Users []struct {
+			ID int64 `json:"id"`
+		} `json:"users"`
+		Missing []int64 `json:"missing_ids"`
+	}
+	decodeData(t, do(t, router, http.MethodGet, "/users?ids=1,2,1", "", nil), &batch)
+	if len(batch.Users) != 1 || batch.Users[0].ID != 1 || len(batch.Missing) != 1 || batch.Missing[0] != 2 {
+		t.Errorf("batch = %+v, want user 1 and the deleted user 2 missing", batch)
+	}
+	decodeData(t, do(t, router, http.MethodGet, "/users?ids=1,2&include_deleted=true", "", nil), &batch)
+	if len(batch.Users) != 2 || len(batch.Missing) != 0 {
+		t.Errorf("batch with deleted users = %+v, want users 1 and 2", batch)
+	}
+
+	p := decodeProblem(t, do(t, router, http.MethodGet, "/users?ids=1,two", "", nil), http.StatusBadRequest, problem.CodeValidationFailed)
+	if len(p.Errors) != 1 || p.Errors[0].Field != "ids" {
+		t.Errorf("errors = %+v, want ids reported", p.Errors)
+	}
+
+	ids := make([]string, usecase.MaxBatchSize+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+	p = decodeProblem(t, do(t, router, http.MethodGet, "/users?ids="+strings.Join(ids, ","), "", nil), http.StatusBadRequest, problem.CodeValidationFailed)
+	if len(p.Errors) != 1 || p.Errors[0].Field != "ids" || p.Errors[0].Code != domain.CodeTooMany {
+		t.Errorf("errors = %+v, want ids reported as too many", p.Errors)
+	}
+}
+
+func TestListUsersPaginates(t *testing.T) {
+	router := newTestRouter()
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		mustCreate(t, router, name)
+	}
+
+	type listResponse struct {
+		Users []struct {
+			Name string `json:"name"`
+		} `json:"users"`
+		NextCursor *string `json:"next_cursor"`
+		Pagination struct {
+			Total   *int64 `json:"total"`
+			HasMore bool   `json:"has_more"`
+		} `json:"pagination"`
+	}
+
+	var first listResponse
+	decodeData(t, do(t, router, http.MethodGet, "/users?page_size=2", "", nil), &first)
+	if len(first.Users) != 2 || first.Users[0].Name != "Carol" {
+		t.Errorf("first page = %+v, want Carol and Bob", first.Users)
+	}
+	if first.Pagination.Total == nil || *first.Pagination.Total != 3 || !first.Pagination.HasMore || first.NextCursor == nil {
+		t.Fatalf("first page pagination = %+v, cursor = %v, want total 3 with more to come", first.Pagination, first.NextCursor)
+	}
+
+	var second listResponse
+	decodeData(t, do(t, router, http.MethodGet, "/users?page_size=2&cursor="+*first.NextCursor, "", nil), &second)
+	if len(second.Users) != 1 || second.Users[0].Name != "Alice" || second.NextCursor != nil {
+		t.Errorf("second page = %+v, cursor = %v, want only Alice and no cursor", second.Users, second.NextCursor)
+	}
+
+	// A page ending exactly at the last user has nothing after it
+	var last listResponse
+	decodeData(t, do(t, router, http.MethodGet, "/users?page_size=3&include_total=false", "", nil), &last)
+	if len(last.Users) != 3 || last.Pagination.HasMore || last.NextCursor != nil {
+		t.Errorf("full last page = %d users, has_more %v, cursor %v, want 3 users and no more", len(last.Users), last.Pagination.HasMore, last.NextCursor)
+	}
+
+	decodeProblem(t, do(t, router, http.MethodGet, "/users?page_size=x", "", nil), http.StatusBadRequest, problem.CodeValidationFailed)
+}
+
+func TestListUsersCapsPageSize(t *testing.T) {
+	router := newTestRouter()
+	mustCreate(t, router, "Alice")
+
+	var page struct {
+		Pagination struct {
+			PageSize int `json:"page_size"`
+		} `json:"pagination"`
+	}
+	decodeData(t, do(t, router, http.MethodGet, "/users?page_size=100000", "", nil), &page)
+	if page.Pagination.PageSize != maxPageSize {
+		t.Errorf("page_size = %d, want %d", page.Pagination.PageSize, maxPageSize)
+	}
+}
+
+func TestSearchUsersRequiresQuery(t *testing.T) {
+	router := newTestRouter()
+
+	p := decodeProblem(t, do(t, router, http.MethodGet, "/users/search", "", nil), http.StatusBadRequest, problem.CodeValidationFailed)
+	if len(p.Errors) != 1 || p.Errors[0].Field != "q" {
+		t.Errorf("field errors = %+v, want one for q", p.Errors)
+	}
+}
+
+func TestUnknownRoutesAreProblems(t *testing.T) {
+	router := newTestRouter()
+
+	decodeProblem(t, do(t, router, http.MethodGet, "/nope", "", nil), http.StatusNotFound, problem.CodeNotFound)
+	decodeProblem(t, do(t, router, http.MethodPut, "/users/1", "", nil), http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed)
+}
+
+func TestRequestContextReachesRepository(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration // Zero for a client that cancels instead
+		status  int
+		code    string
+		want    error
+	}{
+		{"cancelled", 0, StatusClientClosedRequest, problem.CodeRequestCancelled, context.Canceled},
+		{"deadline", 20 * time.Millisecond, http.StatusGatewayTimeout, problem.CodeTimeout, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entered := make(chan struct{})
+			seen := make(chan error, 1)
+			router := newStubRouter(func(ctx context.Context, id int64) (*domain.User, error) {
+				close(entered)
+				<-ctx.Done()
+				seen <- ctx.Err()
+				return nil, ctx.Err()
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+			}
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				router.ServeHTTP(rec, req)
+				close(done)
+			}()
+
+			// The client goes away while the query runs
+			<-entered
+			if tt.timeout == 0 {
+				cancel()
+			}
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("request did not stop")
+			}
+
+			if err := <-seen; !errors.Is(err, tt.want) {
+				t.Errorf("repository saw %v, want %v", err, tt.want)
+			}
+			decodeProblem(t, rec, tt.status, tt.code)
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Package migrate applies versioned SQL schema migrations.
+//
+// Migrations are read from a file system (usually an embed.FS) holding pairs
+// of files named NNNN_description.up.sql and NNNN_description.down.sql,
+// where NNNN is the version. Applied versions are recorded in the
+// schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about, which means it was migrated by a newer
+// release
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// Placeholder formats the n-th (1-based) bind parameter of a query
+type Placeholder func(n int) string
+
+// QuestionMark formats bind parameters as "?", as used by SQLite
+func QuestionMark(int) string { return "?" }
+
+// Dollar formats bind parameters as "$1", "$2", ..., as used by PostgreSQL
+func Dollar(n int) string { return "$" + strconv.Itoa(n) }
+
+// Migration is a single schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt int64 // Microseconds timestamp, zero when not applied
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db          *sql.DB
+	migrations  []Migration
+	placeholder Placeholder
+}
+
+// New creates a migrator for db using the migrations found in fsys
+func New(db *sql.DB, fsys fs.FS, placeholder Placeholder) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:          db,
+		migrations:  migrations,
+		placeholder: placeholder,
+	}, nil
+}
+
+// Load reads migrations from the root of fsys, ordered by version. Every
+// version needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, ".sql")
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+		base = strings.TrimSuffix(base, "."+direction)
+
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named NNNN_description", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s has an invalid version", fileName)
+		}
+
+		content, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Latest returns the highest version known to the migrator
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations in a single transaction and returns
+// the ones it applied. It fails with ErrSchemaTooNew if the database is
+// ahead of the known migrations.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	applied, err := m.appliedVersions(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkNotTooNew(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return nil, fmt.Errorf("failed to apply migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if err := m.record(ctx, tx, migration); err != nil {
+			return nil, err
+		}
+		done = append(done, migration)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit migrations: %w", err)
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied steps migrations, newest first,
+// in a single transaction and returns the ones it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	applied, err := m.appliedVersions(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkNotTooNew(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return nil, fmt.Errorf("failed to roll back migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		query := "DELETE FROM schema_migrations WHERE version = " + m.placeholder(1)
+		if _, err := tx.ExecContext(ctx, query, migration.Version); err != nil {
+			return nil, fmt.Errorf("failed to unrecord migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit migrations: %w", err)
+	}
+	return done, nil
+}
+
+// Status reports every known migration and whether it has been applied. It
+// fails with ErrSchemaTooNew if the database is ahead of the known migrations.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = Status{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+
+	return statuses, m.checkNotTooNew(applied)
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it. It is meant for databases whose schema was created
+// before migrations were tracked, and does nothing once any migration has
+// been recorded.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin baseline: %w", err)
+	}
+	defer tx.Rollback()
+
+	applied, err := m.appliedVersions(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		return nil
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if err := m.record(ctx, tx, migration); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit baseline: %w", err)
+	}
+	return nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ensureTable creates the schema_migrations table if it does not exist
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		)
+	`
+	if _, err := m.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedVersions maps every applied version to the time it was applied
+func (m *Migrator) appliedVersions(ctx context.Context, q queryer) (map[int]int64, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// checkNotTooNew fails if any applied version is unknown to the migrator
+func (m *Migrator) checkNotTooNew(applied map[int]int64) error {
+	latest := m.Latest()
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrSchemaTooNew, version, latest)
+		}
+	}
+	return nil
+}
+
+// record marks migration as applied
+func (m *Migrator) record(ctx context.Context, tx *sql.Tx, migration Migration) error {
+	query := fmt.Sprintf(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+		m.placeholder(1), m.placeholder(2), m.placeholder(3),
+	)
+	if _, err := tx.ExecContext(ctx, query, migration.Version, migration.Name, time.Now().UnixMicro()); err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
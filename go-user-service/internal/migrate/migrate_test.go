@@ -0,0 +1,284 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testMigrations creates a table, adds a column to it and indexes it
+var testMigrations = fstest.MapFS{
+	"0001_create_notes.up.sql":         {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL);")},
+	"0001_create_notes.down.sql":       {Data: []byte("DROP TABLE notes;")},
+	"0002_add_notes_author.up.sql":     {Data: []byte("ALTER TABLE notes ADD COLUMN author TEXT;")},
+	"0002_add_notes_author.down.sql":   {Data: []byte("ALTER TABLE notes DROP COLUMN author;")},
+	"0003_index_notes_author.up.sql":   {Data: []byte("CREATE INDEX idx_notes_author ON notes (author);")},
+	"0003_index_notes_author.down.sql": {Data: []byte("DROP INDEX idx_notes_author;")},
+}
+
+// openTestDB opens a fresh SQLite database file
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestMigrator returns a migrator for db with the migrations in fsys
+func newTestMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	m, err := New(db, fsys, QuestionMark)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return m
+}
+
+// versions lists the versions of migrations
+func versions(migrations []Migration) []int {
+	var vs []int
+	for _, m := range migrations {
+		vs = append(vs, m.Version)
+	}
+	return vs
+}
+
+// appliedVersionsOf lists the versions Status reports as applied
+func appliedVersionsOf(t *testing.T, m *Migrator) []int {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	var vs []int
+	for _, s := range statuses {
+		if s.Applied {
+			vs = append(vs, s.Version)
+		}
+	}
+	return vs
+}
+
+// assertVersions fails the test unless got equals want
+func assertVersions(t *testing.T, what string, got []int, want ...int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
+
+// hasIndex reports whether the database has the named index
+func hasIndex(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, name).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestLoadOrdersMigrationsByVersion(t *testing.T) {
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	assertVersions(t, "versions", versions(migrations), 1, 2, 3)
+	if migrations[1].Name != "add_notes_author" || !strings.Contains(migrations[1].Up, "ADD COLUMN author") {
+		t.Errorf("migration 2 = %+v", migrations[1])
+	}
+}
+
+func TestLoadRejectsBadMigrationFiles(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"no direction", fstest.MapFS{"0001_a.sql": file}, "must end in .up.sql or .down.sql"},
+		{"no name", fstest.MapFS{"0001.up.sql": file}, "must be named NNNN_description"},
+		{"bad version", fstest.MapFS{"first_a.up.sql": file}, "invalid version"},
+		{"zero version", fstest.MapFS{"0000_a.up.sql": file}, "invalid version"},
+		{"missing down", fstest.MapFS{"0001_a.up.sql": file}, "needs both an up and a down file"},
+		{"version reused", fstest.MapFS{"0001_a.up.sql": file, "0001_b.down.sql": file}, "is used by both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpAppliesPendingMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := newTestMigrator(t, db, testMigrations)
+
+	assertVersions(t, "applied before Up", appliedVersionsOf(t, m))
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	assertVersions(t, "applied by Up", versions(done), 1, 2, 3)
+	if _, err := db.Exec(`INSERT INTO notes (body, author) VALUES ('hi', 'ada')`); err != nil {
+		t.Errorf("migrated table is unusable: %v", err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.AppliedAt == 0 {
+			t.Errorf("status of %04d = %+v, want applied with a time", s.Version, s)
+		}
+	}
+
+	done, err = m.Up(ctx)
+	if err != nil || len(done) != 0 {
+		t.Errorf("second Up() = %v, %v, want nothing applied", versions(done), err)
+	}
+}
+
+func TestUpRollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	broken := fstest.MapFS{
+		"0001_create_notes.up.sql":   testMigrations["0001_create_notes.up.sql"],
+		"0001_create_notes.down.sql": testMigrations["0001_create_notes.down.sql"],
+		"0002_broken.up.sql":         {Data: []byte("ALTER TABLE missing ADD COLUMN x TEXT;")},
+		"0002_broken.down.sql":       {Data: []byte("SELECT 1;")},
+	}
+	m := newTestMigrator(t, db, broken)
+
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "0002_broken") {
+		t.Fatalf("Up() error = %v, want migration 0002_broken to fail", err)
+	}
+	assertVersions(t, "applied after a failed Up", appliedVersionsOf(t, m))
+	if _, err := db.Exec(`SELECT * FROM notes`); err == nil {
+		t.Error("table of the first migration was kept")
+	}
+}
+
+func TestDownRollsBackNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := newTestMigrator(t, db, testMigrations)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	done, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatalf("Down(2) error = %v", err)
+	}
+	assertVersions(t, "rolled back", versions(done), 3, 2)
+	assertVersions(t, "applied", appliedVersionsOf(t, m), 1)
+	if hasIndex(t, db, "idx_notes_author") {
+		t.Error("index of migration 3 is still there")
+	}
+
+	done, err = m.Down(ctx, 5)
+	if err != nil {
+		t.Fatalf("Down(5) error = %v", err)
+	}
+	assertVersions(t, "rolled back", versions(done), 1)
+	assertVersions(t, "applied", appliedVersionsOf(t, m))
+}
+
+func TestDownAndUpRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := newTestMigrator(t, db, testMigrations)
+
+	for round := 0; round < 2; round++ {
+		if _, err := m.Up(ctx); err != nil {
+			t.Fatalf("round %d: Up() error = %v", round, err)
+		}
+		if !hasIndex(t, db, "idx_notes_author") {
+			t.Fatalf("round %d: schema is not at the latest version", round)
+		}
+		if _, err := m.Down(ctx, m.Latest()); err != nil {
+			t.Fatalf("round %d: Down() error = %v", round, err)
+		}
+		assertVersions(t, "applied after Down", appliedVersionsOf(t, m))
+	}
+}
+
+func TestBaselineRecordsWithoutRunning(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	// A schema made by hand before migrations were tracked
+	if _, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL, author TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestMigrator(t, db, testMigrations)
+
+	if err := m.Baseline(ctx, 2); err != nil {
+		t.Fatalf("Baseline() error = %v", err)
+	}
+	assertVersions(t, "applied after Baseline", appliedVersionsOf(t, m), 1, 2)
+
+	// Once migrations are recorded, baselining again changes nothing
+	if err := m.Baseline(ctx, 3); err != nil {
+		t.Fatalf("second Baseline() error = %v", err)
+	}
+	assertVersions(t, "applied after second Baseline", appliedVersionsOf(t, m), 1, 2)
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	assertVersions(t, "applied by Up", versions(done), 3)
+}
+
+func TestSchemaNewerThanBinary(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if _, err := newTestMigrator(t, db, testMigrations).Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	// An older binary that only knows the first two migrations
+	older := fstest.MapFS{}
+	for name, file := range testMigrations {
+		if !strings.HasPrefix(name, "0003_") {
+			older[name] = file
+		}
+	}
+	m := newTestMigrator(t, db, older)
+
+	if _, err := m.Up(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Up() error = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Down() error = %v, want ErrSchemaTooNew", err)
+	}
+	statuses, err := m.Status(ctx)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Status() error = %v, want ErrSchemaTooNew", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || !statuses[1].Applied {
+		t.Errorf("Status() = %+v, want the known migrations reported alongside the error", statuses)
+	}
+	if !hasIndex(t, db, "idx_notes_author") {
+		t.Error("schema was changed by the older binary")
+	}
+}
@@ -0,0 +1,86 @@
+// Package problem defines the error responses of the service: RFC 7807
+// problem details extended with a stable machine-readable code, per-field
+// errors and the ID of the request that failed.
+package problem
+
+import (
+	"net/http"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// typePrefix prefixes a code to form the problem type URI
+const typePrefix = "urn:problem-type:"
+
+// Codes of problems that are not specific to a domain. Codes never change
+// once published; clients match on them rather than on titles or details.
+const (
+	CodeValidationFailed     = "validation_failed"
+	CodeMalformedBody        = "malformed_body"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+	CodePreconditionRequired = "precondition_required"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeRequestCancelled     = "request_cancelled"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal_error"
+)
+
+// statusClientClosedRequest is the non-standard status of a request the
+// client cancelled, which net/http has no text for
+const statusClientClosedRequest = 499
+
+// Problem is an RFC 7807 problem details object. Code identifies the problem
+// and determines Type; RequestID ties the response to the service's logs.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a problem with a single input field
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// New creates a problem with the given status, code and detail
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   TypeURI(code),
+		Title:  Title(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// TypeURI returns the problem type URI of code
+func TypeURI(code string) string {
+	return typePrefix + code
+}
+
+// Title returns the standard text of status, used as the problem title
+func Title(status int) string {
+	if status == statusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// Error implements the error interface
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
@@ -0,0 +1,121 @@
+// Package instrumented provides a repository.UserRepository decorator that
+// traces every call and records its latency and failures.
+package instrumented
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/metrics"
+	"github.com/ucups/go-user-service/internal/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates a span for every repository call
+var tracer = otel.Tracer("github.com/ucups/go-user-service/internal/repository/instrumented")
+
+// UserRepository wraps another UserRepository, starting a span for each
+// call and reporting it to metrics labelled with the database driver and
+// the operation
+type UserRepository struct {
+	next    repository.UserRepository
+	driver  string
+	metrics *metrics.Metrics
+}
+
+// NewUserRepository instruments next, which is backed by driver
+func NewUserRepository(next repository.UserRepository, driver string, m *metrics.Metrics) *UserRepository {
+	return &UserRepository{next: next, driver: driver, metrics: m}
+}
+
+// Create adds a new user
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	ctx, finish := r.start(ctx, "Create", "create")
+	err := r.next.Create(ctx, user)
+	finish(err)
+	return err
+}
+
+// GetByID retrieves a user by ID
+func (r *UserRepository) GetByID(ctx context.Context, id int64, includeDeleted bool) (*domain.User, error) {
+	ctx, finish := r.start(ctx, "GetByID", "get_by_id")
+	user, err := r.next.GetByID(ctx, id, includeDeleted)
+	finish(err)
+	return user, err
+}
+
+// GetByIDs retrieves the users matching the given IDs
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []int64, includeDeleted bool) ([]*domain.User, error) {
+	ctx, finish := r.start(ctx, "GetByIDs", "get_by_ids")
+	users, err := r.next.GetByIDs(ctx, ids, includeDeleted)
+	finish(err)
+	return users, err
+}
+
+// Update persists changes to an existing user
+func (r *UserRepository) Update(ctx context.Context, user *domain.User, expectedUpdatedAt int64) error {
+	ctx, finish := r.start(ctx, "Update", "update")
+	err := r.next.Update(ctx, user, expectedUpdatedAt)
+	finish(err)
+	return err
+}
+
+// GetAll retrieves a page of users
+func (r *UserRepository) GetAll(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	ctx, finish := r.start(ctx, "GetAll", listOperation("get_all", filter))
+	users, err := r.next.GetAll(ctx, filter)
+	finish(err)
+	return users, err
+}
+
+// Count returns how many users match filter
+func (r *UserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	ctx, finish := r.start(ctx, "Count", listOperation("count", filter))
+	count, err := r.next.Count(ctx, filter)
+	finish(err)
+	return count, err
+}
+
+// Close closes the wrapped repository
+func (r *UserRepository) Close() error {
+	return r.next.Close()
+}
+
+// start starts the span of a call to method, reported to metrics as
+// operation. The returned function ends the span and records the call.
+// Domain errors such as a missing user or a stale update are answers, not
+// failures, and are not counted as errors.
+func (r *UserRepository) start(ctx context.Context, method, operation string) (context.Context, func(error)) {
+	begin := time.Now()
+	ctx, span := tracer.Start(ctx, "UserRepository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", r.driver),
+			attribute.String("db.operation", operation),
+		),
+	)
+	return ctx, func(err error) {
+		var domainErr *domain.Error
+		failed := err != nil && !errors.As(err, &domainErr)
+		if failed {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		r.metrics.ObserveQuery(r.driver, operation, time.Since(begin), failed)
+	}
+}
+
+// listOperation names a GetAll or Count call. Full-text searches run very
+// different queries from plain listings, so they are reported apart.
+func listOperation(operation string, filter domain.UserFilter) string {
+	if filter.Query != "" {
+		return operation + "_search"
+	}
+	return operation
+}
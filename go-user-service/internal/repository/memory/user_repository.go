@@ -0,0 +1,262 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ucups/go-user-service/internal/domain"
+)
+
+// userRepository keeps users in memory. It is safe for concurrent use and
+// hands out copies, so callers never share state with the store.
+type userRepository struct {
+	mu     sync.RWMutex
+	users  map[int64]*domain.User
+	nextID int64
+}
+
+// NewUserRepository creates a new, empty in-memory user repository
+func NewUserRepository() *userRepository {
+	return &userRepository{
+		users:  make(map[int64]*domain.User),
+		nextID: 1,
+	}
+}
+
+// copyUser returns a deep copy of user
+func copyUser(user *domain.User) *domain.User {
+	c := *user
+	if user.Email != nil {
+		email := *user.Email
+		c.Email = &email
+	}
+	if user.Phone != nil {
+		phone := *user.Phone
+		c.Phone = &phone
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	return &c
+}
+
+// Create adds a new user to the store
+func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.Email != nil {
+		for _, other := range r.users {
+			if other.Email != nil && *other.Email == *user.Email {
+				return domain.ErrEmailTaken
+			}
+		}
+	}
+
+	user.ID = r.nextID
+	r.nextID++
+	r.users[user.ID] = copyUser(user)
+	return nil
+}
+
+// GetByID retrieves a user by ID
+func (r *userRepository) GetByID(ctx context.Context, id int64, includeDeleted bool) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || (user.IsDeleted() && !includeDeleted) {
+		return nil, domain.ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+// GetByIDs retrieves the users matching the given IDs, ordered by ID
+func (r *userRepository) GetByIDs(ctx context.Context, ids []int64, includeDeleted bool) ([]*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*domain.User, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		user, ok := r.users[id]
+		if !ok || seen[id] || (user.IsDeleted() && !includeDeleted) {
+			continue
+		}
+		seen[id] = true
+		users = append(users, copyUser(user))
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// Update writes the user's changes if its stored version is still expectedUpdatedAt
+func (r *userRepository) Update(ctx context.Context, user *domain.User, expectedUpdatedAt int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	if stored.UpdatedAt != expectedUpdatedAt {
+		return domain.ErrStaleUser
+	}
+
+	updated := copyUser(user)
+	updated.CreatedAt = stored.CreatedAt
+	r.users[user.ID] = updated
+	return nil
+}
+
+// GetAll retrieves a page of users, newest first
+func (r *userRepository) GetAll(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]*domain.User, 0, len(r.users))
+	for _, user := range r.users {
+		if !matches(user, filter) {
+			continue
+		}
+		if filter.After != nil && !sortsAfter(user, filter.After) {
+			continue
+		}
+		all = append(all, user)
+	}
+
+	// Newest first, with the ID as a stable tie-breaker. Searches put the
+	// best matches first.
+	var scores map[int64]int
+	if filter.Query != "" {
+		terms := domain.SearchTerms(filter.Query)
+		scores = make(map[int64]int, len(all))
+		for _, user := range all {
+			scores[user.ID] = searchScore(user, terms)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if scores[all[i].ID] != scores[all[j].ID] {
+			return scores[all[i].ID] > scores[all[j].ID]
+		}
+		if all[i].CreatedAt != all[j].CreatedAt {
+			return all[i].CreatedAt > all[j].CreatedAt
+		}
+		return all[i].ID > all[j].ID
+	})
+
+	offset := 0
+	if filter.After == nil {
+		offset = filter.Offset()
+	}
+	if offset < 0 || offset >= len(all) {
+		return []*domain.User{}, nil
+	}
+	end := offset + filter.MaxUsers()
+	if end > len(all) {
+		end = len(all)
+	}
+
+	users := make([]*domain.User, 0, end-offset)
+	for _, user := range all[offset:end] {
+		users = append(users, copyUser(user))
+	}
+	return users, nil
+}
+
+// Count returns how many users match filter
+func (r *userRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, user := range r.users {
+		if matches(user, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// matches reports whether user is selected by filter, regardless of pagination
+func matches(user *domain.User, filter domain.UserFilter) bool {
+	if user.IsDeleted() && !filter.IncludeDeleted {
+		return false
+	}
+	if filter.Query == "" {
+		return true
+	}
+
+	words := domain.SearchTerms(user.Name)
+	for _, term := range domain.SearchTerms(filter.Query) {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchScore ranks a user matching terms: every term that is a whole word
+// of the name, rather than just a prefix of one, counts once
+func searchScore(user *domain.User, terms []string) int {
+	words := make(map[string]bool)
+	for _, word := range domain.SearchTerms(user.Name) {
+		words[word] = true
+	}
+
+	score := 0
+	for _, term := range terms {
+		if words[term] {
+			score++
+		}
+	}
+	return score
+}
+
+// sortsAfter reports whether user comes after cursor in newest first order
+func sortsAfter(user *domain.User, cursor *domain.UserCursor) bool {
+	if user.CreatedAt != cursor.CreatedAt {
+		return user.CreatedAt < cursor.CreatedAt
+	}
+	return user.ID < cursor.ID
+}
+
+// Close releases the store. The in-memory repository holds no resources.
+func (r *userRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/repository"
+	"github.com/ucups/go-user-service/internal/repository/repositorytest"
+)
+
+func TestUserRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.UserRepository {
+		return NewUserRepository()
+	})
+}
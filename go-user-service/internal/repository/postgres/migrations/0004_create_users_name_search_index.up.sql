@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_users_name_search ON users USING GIN (to_tsvector('simple', name));
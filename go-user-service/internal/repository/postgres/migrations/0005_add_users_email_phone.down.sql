@@ -0,0 +1,3 @@
+DROP INDEX idx_users_email;
+ALTER TABLE users DROP COLUMN phone;
+ALTER TABLE users DROP COLUMN email;
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ucups/go-user-service/internal/repository"
+	"github.com/ucups/go-user-service/internal/repository/repositorytest"
+)
+
+// testDSNEnv names the environment variable holding the DSN of a database
+// the tests may create schemas in. The tests are skipped when it is unset.
+const testDSNEnv = "TEST_POSTGRES_DSN"
+
+func TestUserRepository(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	repositorytest.Run(t, func(t *testing.T) repository.UserRepository {
+		// Every subtest gets an empty schema of its own
+		schema := fmt.Sprintf("repositorytest_%d", time.Now().UnixNano())
+		if _, err := admin.Exec("CREATE SCHEMA " + pq.QuoteIdentifier(schema)); err != nil {
+			t.Fatalf("failed to create schema: %v", err)
+		}
+		t.Cleanup(func() {
+			if _, err := admin.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE"); err != nil {
+				t.Errorf("failed to drop schema: %v", err)
+			}
+		})
+
+		repo, err := NewUserRepository(withSearchPath(t, dsn, schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	})
+}
+
+// withSearchPath returns dsn with its search_path set to schema, so that
+// every connection opened from it works in that schema
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		converted, err := pq.ParseURL(dsn)
+		if err != nil {
+			t.Fatalf("invalid %s: %v", testDSNEnv, err)
+		}
+		dsn = converted
+	}
+	return dsn + " search_path=" + schema
+}
@@ -0,0 +1,591 @@
+// Package repositorytest provides a conformance suite that every
+// repository.UserRepository implementation must pass.
+//
+// A backend runs the suite from its own tests:
+//
+//	func TestUserRepository(t *testing.T) {
+//		repositorytest.Run(t, func(t *testing.T) repository.UserRepository {
+//			repo, err := NewUserRepository(filepath.Join(t.TempDir(), "users.db"))
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			t.Cleanup(func() { repo.Close() })
+//			return repo
+//		})
+//	}
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/repository"
+)
+
+// Factory returns a new, empty repository. It is called once per subtest and
+// is responsible for releasing the repository when the test ends.
+type Factory func(t *testing.T) repository.UserRepository
+
+// Run runs the conformance suite against repositories created by newRepo
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("IDAssignment", func(t *testing.T) { testIDAssignment(t, newRepo(t)) })
+	t.Run("CreateAndGetByID", func(t *testing.T) { testCreateAndGetByID(t, newRepo(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newRepo(t)) })
+	t.Run("Pagination", func(t *testing.T) { testPagination(t, newRepo(t)) })
+	t.Run("KeysetPagination", func(t *testing.T) { testKeysetPagination(t, newRepo(t)) })
+	t.Run("Count", func(t *testing.T) { testCount(t, newRepo(t)) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, newRepo(t)) })
+	t.Run("ContactDetails", func(t *testing.T) { testContactDetails(t, newRepo(t)) })
+	t.Run("EmailVariants", func(t *testing.T) { testEmailVariants(t, newRepo(t)) })
+	t.Run("ConcurrentCreates", func(t *testing.T) { testConcurrentCreates(t, newRepo(t)) })
+	t.Run("GetByIDs", func(t *testing.T) { testGetByIDs(t, newRepo(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newRepo(t)) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, newRepo(t)) })
+	t.Run("CancelledContext", func(t *testing.T) { testCancelledContext(t, newRepo(t)) })
+}
+
+// mustCreate stores a new user with the given name and creation time
+func mustCreate(t *testing.T, repo repository.UserRepository, name string, createdAt int64) *domain.User {
+	t.Helper()
+
+	user := &domain.User{Name: name, CreatedAt: createdAt, UpdatedAt: createdAt}
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create(%q) failed: %v", name, err)
+	}
+	return user
+}
+
+func testIDAssignment(t *testing.T, repo repository.UserRepository) {
+	first := mustCreate(t, repo, "Alice", 1000)
+	second := mustCreate(t, repo, "Bob", 2000)
+
+	if first.ID <= 0 {
+		t.Errorf("first ID = %d, want a positive ID", first.ID)
+	}
+	if second.ID <= first.ID {
+		t.Errorf("second ID = %d, want greater than first ID %d", second.ID, first.ID)
+	}
+}
+
+func testCreateAndGetByID(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, "Alice", 1000)
+
+	got, err := repo.GetByID(ctx, created.ID, false)
+	if err != nil {
+		t.Fatalf("GetByID(%d) failed: %v", created.ID, err)
+	}
+	if got.ID != created.ID || got.Name != "Alice" || got.CreatedAt != 1000 || got.UpdatedAt != 1000 {
+		t.Errorf("GetByID(%d) = %+v, want %+v", created.ID, got, created)
+	}
+	if got.DeletedAt != nil {
+		t.Errorf("GetByID(%d).DeletedAt = %d, want nil", created.ID, *got.DeletedAt)
+	}
+}
+
+func testNotFound(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	if _, err := repo.GetByID(ctx, 42, false); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetByID on empty repository error = %v, want domain.ErrNotFound", err)
+	}
+	if _, err := repo.GetByID(ctx, 42, true); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetByID with includeDeleted on empty repository error = %v, want domain.ErrNotFound", err)
+	}
+
+	user := mustCreate(t, repo, "Alice", 1000)
+	if _, err := repo.GetByID(ctx, user.ID+1, false); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetByID(%d) error = %v, want domain.ErrNotFound", user.ID+1, err)
+	}
+
+	users, err := repo.GetByIDs(ctx, []int64{user.ID + 1, user.ID + 2}, false)
+	if err != nil {
+		t.Fatalf("GetByIDs of unknown IDs failed: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("GetByIDs of unknown IDs returned %d users, want 0", len(users))
+	}
+}
+
+func testPagination(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	// Insert out of creation order so that ordering by ID would fail
+	for _, createdAt := range []int64{3000, 1000, 5000, 2000, 4000} {
+		mustCreate(t, repo, "User", createdAt)
+	}
+
+	pages := [][]int64{{5000, 4000}, {3000, 2000}, {1000}, {}}
+	for i, want := range pages {
+		pageNum := i + 1
+		users, err := repo.GetAll(ctx, domain.UserFilter{PageNum: pageNum, PageSize: 2})
+		if err != nil {
+			t.Fatalf("GetAll page %d failed: %v", pageNum, err)
+		}
+
+		got := make([]int64, len(users))
+		for j, user := range users {
+			got[j] = user.CreatedAt
+		}
+		if len(got) != len(want) {
+			t.Fatalf("GetAll page %d returned created_at %v, want %v", pageNum, got, want)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("GetAll page %d returned created_at %v, want %v", pageNum, got, want)
+			}
+		}
+	}
+
+	// A limit past the page size reads on from the same offset
+	users, err := repo.GetAll(ctx, domain.UserFilter{PageNum: 2, PageSize: 2, Limit: 3})
+	if err != nil {
+		t.Fatalf("GetAll with a limit failed: %v", err)
+	}
+	if len(users) != 3 || users[0].CreatedAt != 3000 || users[2].CreatedAt != 1000 {
+		t.Errorf("GetAll page 2 with limit 3 returned %d users, want created_at 3000 to 1000", len(users))
+	}
+}
+
+func testKeysetPagination(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	// Users sharing a creation time must be ordered by ID, newest first
+	var want []int64
+	for _, createdAt := range []int64{1000, 2000, 2000, 2000, 3000} {
+		user := mustCreate(t, repo, "User", createdAt)
+		want = append([]int64{user.ID}, want...)
+	}
+
+	var got []int64
+	var after *domain.UserCursor
+	for page := 0; page < 10; page++ {
+		users, err := repo.GetAll(ctx, domain.UserFilter{PageNum: 1, PageSize: 2, After: after})
+		if err != nil {
+			t.Fatalf("GetAll after %+v failed: %v", after, err)
+		}
+		if len(users) == 0 {
+			break
+		}
+		for _, user := range users {
+			got = append(got, user.ID)
+		}
+		after = domain.CursorAfter(users[len(users)-1])
+
+		// A user created while paging sorts before the cursor and must not
+		// shift the remaining pages
+		if page == 0 {
+			mustCreate(t, repo, "Late", 4000)
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("keyset pages returned IDs %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("keyset pages returned IDs %v, want %v", got, want)
+		}
+	}
+}
+
+func testCount(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	count, err := repo.Count(ctx, domain.UserFilter{})
+	if err != nil {
+		t.Fatalf("Count on empty repository failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Count on empty repository = %d, want 0", count)
+	}
+
+	for _, createdAt := range []int64{1000, 2000, 3000} {
+		mustCreate(t, repo, "User", createdAt)
+	}
+	deleted := mustCreate(t, repo, "Deleted", 4000)
+	deletedAt := int64(5000)
+	deleted.UpdatedAt = 5000
+	deleted.DeletedAt = &deletedAt
+	if err := repo.Update(ctx, deleted, 4000); err != nil {
+		t.Fatalf("Update to soft delete failed: %v", err)
+	}
+
+	// Pagination must not affect the count
+	filter := domain.UserFilter{PageNum: 2, PageSize: 1, After: &domain.UserCursor{CreatedAt: 2000, ID: 1}}
+	if count, err := repo.Count(ctx, filter); err != nil || count != 3 {
+		t.Errorf("Count = %d, %v, want 3 users", count, err)
+	}
+
+	filter.IncludeDeleted = true
+	if count, err := repo.Count(ctx, filter); err != nil || count != 4 {
+		t.Errorf("Count with includeDeleted = %d, %v, want 4 users", count, err)
+	}
+}
+
+func testSearch(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	johnSmith := mustCreate(t, repo, "John Smith", 1000)
+	johnny := mustCreate(t, repo, "Johnny Walker", 2000)
+	mustCreate(t, repo, "Alice Jones", 3000)
+	deleted := mustCreate(t, repo, "John Deleted", 4000)
+	deletedAt := int64(5000)
+	deleted.UpdatedAt = 5000
+	deleted.DeletedAt = &deletedAt
+	if err := repo.Update(ctx, deleted, 4000); err != nil {
+		t.Fatalf("Update to soft delete failed: %v", err)
+	}
+
+	search := func(query string, includeDeleted bool) []int64 {
+		t.Helper()
+		filter := domain.UserFilter{PageNum: 1, PageSize: 10, Query: query, IncludeDeleted: includeDeleted}
+		users, err := repo.GetAll(ctx, filter)
+		if err != nil {
+			t.Fatalf("GetAll with query %q failed: %v", query, err)
+		}
+		count, err := repo.Count(ctx, filter)
+		if err != nil {
+			t.Fatalf("Count with query %q failed: %v", query, err)
+		}
+		if count != int64(len(users)) {
+			t.Errorf("Count with query %q = %d, want %d", query, count, len(users))
+		}
+
+		ids := make([]int64, len(users))
+		for i, user := range users {
+			ids[i] = user.ID
+		}
+		return ids
+	}
+	sameIDs := func(got []int64, want ...int64) bool {
+		found := make(map[int64]bool)
+		for _, id := range got {
+			found[id] = true
+		}
+		if len(found) != len(got) || len(got) != len(want) {
+			return false
+		}
+		for _, id := range want {
+			if !found[id] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Terms match word prefixes, case insensitively
+	if got := search("JOHN", false); !sameIDs(got, johnSmith.ID, johnny.ID) {
+		t.Errorf("search %q returned IDs %v, want %d and %d", "JOHN", got, johnSmith.ID, johnny.ID)
+	}
+	// Every term must match
+	if got := search("jo sm", false); !sameIDs(got, johnSmith.ID) {
+		t.Errorf("search %q returned IDs %v, want %d", "jo sm", got, johnSmith.ID)
+	}
+	// Operators of the underlying search syntax are plain text
+	if got := search(`walk" OR "alice*`, false); !sameIDs(got) {
+		t.Errorf("search with operators returned IDs %v, want none", got)
+	}
+	if got := search("john", true); !sameIDs(got, johnSmith.ID, johnny.ID, deleted.ID) {
+		t.Errorf("search %q with includeDeleted returned IDs %v, want 3 users", "john", got)
+	}
+
+	// Renames are searchable right away
+	johnny.Name = "Jack Walker"
+	johnny.UpdatedAt = 6000
+	if err := repo.Update(ctx, johnny, 2000); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got := search("john", false); !sameIDs(got, johnSmith.ID) {
+		t.Errorf("search %q after rename returned IDs %v, want %d", "john", got, johnSmith.ID)
+	}
+	if got := search("jack", false); !sameIDs(got, johnny.ID) {
+		t.Errorf("search %q after rename returned IDs %v, want %d", "jack", got, johnny.ID)
+	}
+}
+
+func testContactDetails(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	email, phone := "jane@example.com", "+6591234567"
+	jane := &domain.User{Name: "Jane", Email: &email, Phone: &phone, CreatedAt: 1000, UpdatedAt: 1000}
+	if err := repo.Create(ctx, jane); err != nil {
+		t.Fatalf("Create with contact details failed: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, jane.ID, false)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Email == nil || *got.Email != email || got.Phone == nil || *got.Phone != phone {
+		t.Errorf("GetByID returned email %v and phone %v, want %s and %s", got.Email, got.Phone, email, phone)
+	}
+
+	// Users without an email never conflict with each other
+	first := mustCreate(t, repo, "No Email", 2000)
+	mustCreate(t, repo, "No Email Either", 3000)
+	if got, err := repo.GetByID(ctx, first.ID, false); err != nil || got.Email != nil || got.Phone != nil {
+		t.Errorf("GetByID of user without contact details = %+v, %v, want no email or phone", got, err)
+	}
+
+	duplicate := &domain.User{Name: "Other Jane", Email: &email, CreatedAt: 4000, UpdatedAt: 4000}
+	if err := repo.Create(ctx, duplicate); !errors.Is(err, domain.ErrEmailTaken) {
+		t.Errorf("Create with a taken email error = %v, want domain.ErrEmailTaken", err)
+	}
+
+	// Soft deleted users keep their email
+	deletedAt := int64(5000)
+	jane.UpdatedAt = 5000
+	jane.DeletedAt = &deletedAt
+	if err := repo.Update(ctx, jane, 1000); err != nil {
+		t.Fatalf("Update to soft delete failed: %v", err)
+	}
+	if err := repo.Create(ctx, duplicate); !errors.Is(err, domain.ErrEmailTaken) {
+		t.Errorf("Create with the email of a deleted user error = %v, want domain.ErrEmailTaken", err)
+	}
+
+	users, err := repo.GetAll(ctx, domain.UserFilter{PageNum: 1, PageSize: 10, IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	for _, user := range users {
+		if user.ID == jane.ID && (user.Email == nil || *user.Email != email) {
+			t.Errorf("GetAll returned email %v for user %d, want %s", user.Email, jane.ID, email)
+		}
+	}
+}
+
+func testEmailVariants(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+
+	jane, err := domain.NewUser("Jane", "jane@example.com", "")
+	if err != nil {
+		t.Fatalf("NewUser failed: %v", err)
+	}
+	if err := repo.Create(ctx, jane); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Addresses that differ only in case or surrounding whitespace are
+	// normalized to the same one and collide
+	for _, email := range []string{"JANE@EXAMPLE.COM", "Jane@Example.com", "  jane@example.com\t"} {
+		user, err := domain.NewUser("Other Jane", email, "")
+		if err != nil {
+			t.Fatalf("NewUser(%q) failed: %v", email, err)
+		}
+		if err := repo.Create(ctx, user); !errors.Is(err, domain.ErrEmailTaken) {
+			t.Errorf("Create with email %q error = %v, want domain.ErrEmailTaken", email, err)
+		}
+	}
+
+	// A different address is still free
+	other, err := domain.NewUser("Joe", "joe@example.com", "")
+	if err != nil {
+		t.Fatalf("NewUser failed: %v", err)
+	}
+	if err := repo.Create(ctx, other); err != nil {
+		t.Errorf("Create with a free email failed: %v", err)
+	}
+}
+
+func testConcurrentCreates(t *testing.T, repo repository.UserRepository) {
+	const workers = 8
+	const perWorker = 10
+
+	var wg sync.WaitGroup
+	ids := make(chan int64, workers*perWorker)
+	errs := make(chan error, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				createdAt := int64(w*perWorker + i + 1)
+				user := &domain.User{Name: "User", CreatedAt: createdAt, UpdatedAt: createdAt}
+				if err := repo.Create(context.Background(), user); err != nil {
+					errs <- err
+					return
+				}
+				ids <- user.ID
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent Create failed: %v", err)
+	}
+
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("ID %d was assigned twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != workers*perWorker {
+		t.Fatalf("created %d users, want %d", len(seen), workers*perWorker)
+	}
+
+	users, err := repo.GetAll(context.Background(), domain.UserFilter{PageNum: 1, PageSize: workers * perWorker * 2})
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(users) != workers*perWorker {
+		t.Errorf("GetAll returned %d users, want %d", len(users), workers*perWorker)
+	}
+}
+
+func testGetByIDs(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	alice := mustCreate(t, repo, "Alice", 1000)
+	bob := mustCreate(t, repo, "Bob", 2000)
+
+	users, err := repo.GetByIDs(ctx, []int64{bob.ID, alice.ID, bob.ID + 1000}, false)
+	if err != nil {
+		t.Fatalf("GetByIDs failed: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("GetByIDs returned %d users, want 2", len(users))
+	}
+
+	found := map[int64]string{}
+	for _, user := range users {
+		found[user.ID] = user.Name
+	}
+	if found[alice.ID] != "Alice" || found[bob.ID] != "Bob" {
+		t.Errorf("GetByIDs returned %v, want Alice and Bob", found)
+	}
+
+	users, err = repo.GetByIDs(ctx, nil, false)
+	if err != nil {
+		t.Fatalf("GetByIDs(nil) failed: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("GetByIDs(nil) returned %d users, want 0", len(users))
+	}
+}
+
+func testUpdate(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := mustCreate(t, repo, "Alice", 1000)
+
+	user.Name = "Alicia"
+	user.UpdatedAt = 2000
+	if err := repo.Update(ctx, user, 1000); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, user.ID, false)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if got.Name != "Alicia" || got.UpdatedAt != 2000 {
+		t.Errorf("after Update got %+v, want name Alicia and updated_at 2000", got)
+	}
+
+	// Writing against the old version must be rejected
+	user.Name = "Alex"
+	user.UpdatedAt = 3000
+	if err := repo.Update(ctx, user, 1000); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("stale Update error = %v, want domain.ErrConflict", err)
+	}
+
+	missing := &domain.User{ID: user.ID + 1000, Name: "Nobody", UpdatedAt: 1}
+	if err := repo.Update(ctx, missing, 0); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Update of missing user error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testSoftDelete(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	user := mustCreate(t, repo, "Alice", 1000)
+
+	deletedAt := int64(2000)
+	user.UpdatedAt = 2000
+	user.DeletedAt = &deletedAt
+	if err := repo.Update(ctx, user, 1000); err != nil {
+		t.Fatalf("Update to soft delete failed: %v", err)
+	}
+
+	if _, err := repo.GetByID(ctx, user.ID, false); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetByID of deleted user error = %v, want domain.ErrNotFound", err)
+	}
+
+	got, err := repo.GetByID(ctx, user.ID, true)
+	if err != nil {
+		t.Fatalf("GetByID with includeDeleted failed: %v", err)
+	}
+	if got.DeletedAt == nil || *got.DeletedAt != deletedAt {
+		t.Errorf("GetByID with includeDeleted DeletedAt = %v, want %d", got.DeletedAt, deletedAt)
+	}
+
+	users, err := repo.GetAll(ctx, domain.UserFilter{PageNum: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("GetAll returned %d users, want deleted user hidden", len(users))
+	}
+
+	users, err = repo.GetByIDs(ctx, []int64{user.ID}, true)
+	if err != nil {
+		t.Fatalf("GetByIDs with includeDeleted failed: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("GetByIDs with includeDeleted returned %d users, want 1", len(users))
+	}
+}
+
+func testCancelledContext(t *testing.T, repo repository.UserRepository) {
+	user := mustCreate(t, repo, "Alice", 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := map[string]func() error{
+		"Create": func() error {
+			return repo.Create(ctx, &domain.User{Name: "Bob", CreatedAt: 2000, UpdatedAt: 2000})
+		},
+		"GetByID": func() error {
+			_, err := repo.GetByID(ctx, user.ID, false)
+			return err
+		},
+		"GetByIDs": func() error {
+			_, err := repo.GetByIDs(ctx, []int64{user.ID}, false)
+			return err
+		},
+		"Update": func() error {
+			renamed := *user
+			renamed.Name, renamed.UpdatedAt = "Alicia", 3000
+			return repo.Update(ctx, &renamed, user.UpdatedAt)
+		},
+		"GetAll": func() error {
+			_, err := repo.GetAll(ctx, domain.UserFilter{PageNum: 1, PageSize: 10})
+			return err
+		},
+		"Count": func() error {
+			_, err := repo.Count(ctx, domain.UserFilter{})
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s with a cancelled context error = %v, want context.Canceled", name, err)
+		}
+	}
+
+	// Nothing was written
+	got, err := repo.GetByID(context.Background(), user.ID, false)
+	if err != nil || got.Name != "Alice" {
+		t.Errorf("GetByID = %+v, %v, want Alice unchanged", got, err)
+	}
+	if count, err := repo.Count(context.Background(), domain.UserFilter{}); err != nil || count != 1 {
+		t.Errorf("Count = %d, %v, want 1", count, err)
+	}
+}
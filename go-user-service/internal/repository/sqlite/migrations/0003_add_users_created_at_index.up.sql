@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id);
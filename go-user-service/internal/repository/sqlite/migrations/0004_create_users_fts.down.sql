@@ -0,0 +1,5 @@
+DROP TRIGGER users_fts_update_after;
+DROP TRIGGER users_fts_update_before;
+DROP TRIGGER users_fts_delete;
+DROP TRIGGER users_fts_insert;
+DROP TABLE users_fts;
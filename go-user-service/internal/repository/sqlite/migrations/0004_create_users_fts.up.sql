@@ -0,0 +1,29 @@
+-- Full-text index over user names. It is an external content table, so the
+-- names are stored only in users and the triggers keep the index in sync:
+-- old names are removed before users change and new ones added after.
+-- FTS4 is used as go-sqlite3 compiles it in by default, unlike FTS5.
+CREATE VIRTUAL TABLE users_fts USING fts4(
+	name,
+	content="users",
+	tokenize=unicode61 "remove_diacritics=2",
+	prefix="2,3"
+);
+
+CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+	INSERT INTO users_fts (docid, name) VALUES (new.id, new.name);
+END;
+
+CREATE TRIGGER users_fts_delete BEFORE DELETE ON users BEGIN
+	DELETE FROM users_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER users_fts_update_before BEFORE UPDATE OF name ON users BEGIN
+	DELETE FROM users_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER users_fts_update_after AFTER UPDATE OF name ON users BEGIN
+	INSERT INTO users_fts (docid, name) VALUES (new.id, new.name);
+END;
+
+-- Index the users that already exist
+INSERT INTO users_fts (users_fts) VALUES ('rebuild');
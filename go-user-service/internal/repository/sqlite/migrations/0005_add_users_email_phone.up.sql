@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN phone TEXT;
+
+-- NULLs never collide, so only users with an email are constrained
+CREATE UNIQUE INDEX idx_users_email ON users (email);
@@ -0,0 +1,199 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/migrate"
+)
+
+// openTestDB opens the database file path with the service's migrations
+func openTestDB(t *testing.T, path string) (*sql.DB, *migrate.Migrator) {
+	t.Helper()
+	db, migrator, err := OpenDB(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, migrator
+}
+
+// createLegacyDB creates a database file with the given schema and no
+// migration records, as made by releases before migrations were tracked
+func createLegacyDB(t *testing.T, schema string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+	return path
+}
+
+// openDBOnly opens path without touching its schema
+func openDBOnly(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// appliedVersions lists the migrations recorded as applied
+func appliedVersions(t *testing.T, migrator *migrate.Migrator) []int {
+	t.Helper()
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	var versions []int
+	for _, s := range statuses {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+// assertApplied fails the test unless exactly versions 1 to upTo are applied
+func assertApplied(t *testing.T, migrator *migrate.Migrator, upTo int) {
+	t.Helper()
+	got := appliedVersions(t, migrator)
+	ok := len(got) == upTo
+	for i := 0; ok && i < upTo; i++ {
+		ok = got[i] == i+1
+	}
+	if !ok {
+		t.Fatalf("applied versions = %v, want 1 to %d", got, upTo)
+	}
+}
+
+const legacyUsersTable = `
+	CREATE TABLE users (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	INSERT INTO users (name, created_at, updated_at) VALUES ('Ada', 1, 1);
+`
+
+func TestOpenDBLeavesFreshDatabaseUnmigrated(t *testing.T) {
+	_, migrator := openTestDB(t, filepath.Join(t.TempDir(), "users.db"))
+	assertApplied(t, migrator, 0)
+
+	done, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if len(done) != migrator.Latest() {
+		t.Errorf("Up() applied %d migrations, want %d", len(done), migrator.Latest())
+	}
+	assertApplied(t, migrator, migrator.Latest())
+}
+
+func TestOpenDBBaselinesLegacySchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		baseline int
+	}{
+		{"without deleted_at", legacyUsersTable, 1},
+		{"with deleted_at", legacyUsersTable + "ALTER TABLE users ADD COLUMN deleted_at INTEGER;", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createLegacyDB(t, tt.schema)
+			_, migrator := openTestDB(t, path)
+			assertApplied(t, migrator, tt.baseline)
+
+			// The rest of the migrations apply on top and keep the data
+			if _, err := migrator.Up(context.Background()); err != nil {
+				t.Fatalf("Up() error = %v", err)
+			}
+			repo := &userRepository{db: openDBOnly(t, path)}
+			user, err := repo.GetByID(context.Background(), 1, false)
+			if err != nil || user.Name != "Ada" {
+				t.Errorf("GetByID(1) = %+v, %v, want the legacy user", user, err)
+			}
+		})
+	}
+}
+
+func TestOpenDBDoesNotBaselineTrackedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	db, migrator := openTestDB(t, path)
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := migrator.Down(context.Background(), migrator.Latest()-1); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	db.Close()
+
+	// Only 0001 is applied and users has no deleted_at, which must not be
+	// taken for a legacy database
+	_, migrator = openTestDB(t, path)
+	assertApplied(t, migrator, 1)
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.db")
+	_, migrator := openTestDB(t, path)
+
+	for round := 0; round < 2; round++ {
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("round %d: Up() error = %v", round, err)
+		}
+		assertApplied(t, migrator, migrator.Latest())
+
+		// Step down one migration at a time so every down file runs against
+		// the schema its up file produced
+		for version := migrator.Latest(); version > 0; version-- {
+			done, err := migrator.Down(ctx, 1)
+			if err != nil {
+				t.Fatalf("round %d: rolling back %04d: %v", round, version, err)
+			}
+			if len(done) != 1 || done[0].Version != version {
+				t.Fatalf("round %d: Down(1) rolled back %+v, want %04d", round, done, version)
+			}
+		}
+		assertApplied(t, migrator, 0)
+	}
+
+	// The migrated schema works with the repository
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	repo, err := NewUserRepository(path)
+	if err != nil {
+		t.Fatalf("NewUserRepository() error = %v", err)
+	}
+	defer repo.Close()
+}
+
+func TestOpenRejectsSchemaNewerThanBinary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	db, migrator := openTestDB(t, path)
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	// A newer release applied a migration this binary does not have
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from_the_future', 1)`, migrator.Latest()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewUserRepository(path); !errors.Is(err, migrate.ErrSchemaTooNew) {
+		t.Errorf("NewUserRepository() error = %v, want ErrSchemaTooNew", err)
+	}
+}
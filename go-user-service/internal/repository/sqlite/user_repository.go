@@ -1,56 +1,165 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/migrate"
 )
 
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
 type userRepository struct {
 	db *sql.DB
 }
 
-// NewUserRepository creates a new SQLite user repository
+// NewUserRepository creates a new SQLite user repository, applying any
+// pending schema migrations first
 func NewUserRepository(dbPath string) (*userRepository, error) {
+	ctx := context.Background()
+
+	db, migrator, err := OpenDB(ctx, dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return &userRepository{db: db}, nil
+}
+
+// OpenDB opens the SQLite database at dbPath and returns it along with a
+// migrator for its schema. Databases created before migrations were
+// tracked are baselined at the version matching their schema.
+func OpenDB(ctx context.Context, dbPath string) (*sql.DB, *migrate.Migrator, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	repo := &userRepository{db: db}
-	if err := repo.initDB(); err != nil {
-		return nil, err
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	migrator, err := migrate.New(db, migrations, migrate.QuestionMark)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	if err := baselineLegacySchema(ctx, db, migrator); err != nil {
+		db.Close()
+		return nil, nil, err
 	}
 
-	return repo, nil
+	return db, migrator, nil
 }
 
-// initDB initializes the database schema
-func (r *userRepository) initDB() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS users (
-			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			created_at INTEGER NOT NULL,
-			updated_at INTEGER NOT NULL
-		);
-	`
-	_, err := r.db.Exec(query)
+// baselineLegacySchema records the migrations already reflected in a users
+// table that was created before migrations were tracked
+func baselineLegacySchema(ctx context.Context, db *sql.DB, migrator *migrate.Migrator) error {
+	hasUsers, err := hasTable(ctx, db, "users")
+	if err != nil || !hasUsers {
+		return err
+	}
+
+	version := 1 // 0001_create_users
+	hasDeletedAt, err := hasColumn(ctx, db, "users", "deleted_at")
 	if err != nil {
-		return fmt.Errorf("failed to create users table: %w", err)
+		return err
+	}
+	if hasDeletedAt {
+		version = 2 // 0002_add_users_deleted_at
+	}
+
+	if err := migrator.Baseline(ctx, version); err != nil {
+		return fmt.Errorf("failed to baseline existing schema: %w", err)
 	}
 	return nil
 }
 
+// hasTable reports whether the database has a table with the given name
+func hasTable(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return count > 0, nil
+}
+
+// hasColumn reports whether table has a column with the given name
+func hasColumn(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// userColumns lists the columns read by scanUser, in order
+const userColumns = "id, name, email, phone, created_at, updated_at, deleted_at"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads a user selected with userColumns
+func scanUser(row rowScanner) (*domain.User, error) {
+	user := &domain.User{}
+	var email, phone sql.NullString
+	var deletedAt sql.NullInt64
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&email,
+		&phone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&deletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if email.Valid {
+		user.Email = &email.String
+	}
+	if phone.Valid {
+		user.Phone = &phone.String
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Int64
+	}
+	return user, nil
+}
+
 // Create adds a new user to the database
-func (r *userRepository) Create(user *domain.User) error {
+func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 	query := `
-		INSERT INTO users (name, created_at, updated_at)
-		VALUES (?, ?, ?)
+		INSERT INTO users (name, email, phone, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, user.Name, user.CreatedAt, user.UpdatedAt)
+	result, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.Phone, user.CreatedAt, user.UpdatedAt)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique && strings.Contains(sqliteErr.Error(), "users.email") {
+		return domain.ErrEmailTaken
+	}
 	if err != nil {
 		return fmt.Errorf("failed to insert user: %w", err)
 	}
@@ -65,21 +174,19 @@ func (r *userRepository) Create(user *domain.User) error {
 }
 
 // GetByID retrieves a user by ID
-func (r *userRepository) GetByID(id int64) (*domain.User, error) {
+func (r *userRepository) GetByID(ctx context.Context, id int64, includeDeleted bool) (*domain.User, error) {
 	query := `
-		SELECT id, name, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`
-	user := &domain.User{}
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Name,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query user: %w", err)
@@ -88,18 +195,116 @@ func (r *userRepository) GetByID(id int64) (*domain.User, error) {
 	return user, nil
 }
 
-// GetAll retrieves all users with pagination
-func (r *userRepository) GetAll(filter domain.UserFilter) ([]*domain.User, error) {
-	limit := filter.PageSize
-	offset := (filter.PageNum - 1) * filter.PageSize
+// GetByIDs retrieves the users matching the given IDs in a single query
+func (r *userRepository) GetByIDs(ctx context.Context, ids []int64, includeDeleted bool) ([]*domain.User, error) {
+	if len(ids) == 0 {
+		return []*domain.User{}, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	where := fmt.Sprintf("id IN (%s)", strings.Join(placeholders, ", "))
+	if !includeDeleted {
+		where += " AND deleted_at IS NULL"
+	}
 
 	query := `
-		SELECT id, name, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
+		WHERE ` + where + `
+		ORDER BY id
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0, len(ids))
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+
+	return users, nil
+}
+
+// Update writes the user's changes if its stored version is still expectedUpdatedAt
+func (r *userRepository) Update(ctx context.Context, user *domain.User, expectedUpdatedAt int64) error {
+	query := `
+		UPDATE users
+		SET name = ?, updated_at = ?, deleted_at = ?
+		WHERE id = ? AND updated_at = ?
 	`
-	rows, err := r.db.Query(query, limit, offset)
+	result, err := r.db.ExecContext(ctx, query, user.Name, user.UpdatedAt, user.DeletedAt, user.ID, expectedUpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// Nothing matched: either the user is gone or someone else changed it
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM users WHERE id = ?`, user.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return domain.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	return domain.ErrStaleUser
+}
+
+// GetAll retrieves a page of users, newest first. Pages after a cursor are
+// read with a keyset condition on (created_at, id) rather than an offset.
+// Searches are ranked by their number of whole-word matches first.
+func (r *userRepository) GetAll(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	source, args := filterSource(filter)
+	conditions, conditionArgs := filterConditions(filter)
+	args = append(args, conditionArgs...)
+	if filter.After != nil {
+		conditions = append(conditions, "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM ` + source
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY "
+	if filter.Query != "" {
+		query += "search.rank DESC, "
+	}
+	query += "created_at DESC, id DESC LIMIT ?"
+	args = append(args, filter.MaxUsers())
+
+	if filter.After == nil {
+		query += " OFFSET ?"
+		args = append(args, filter.Offset())
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -107,13 +312,7 @@ func (r *userRepository) GetAll(filter domain.UserFilter) ([]*domain.User, error
 
 	var users []*domain.User
 	for rows.Next() {
-		user := &domain.User{}
-		err := rows.Scan(
-			&user.ID,
-			&user.Name,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
@@ -127,6 +326,76 @@ func (r *userRepository) GetAll(filter domain.UserFilter) ([]*domain.User, error
 	return users, nil
 }
 
+// Count returns how many users match filter
+func (r *userRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	source, args := filterSource(filter)
+	conditions, conditionArgs := filterConditions(filter)
+	args = append(args, conditionArgs...)
+
+	query := "SELECT COUNT(*) FROM " + source
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var count int64
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// filterSource returns the FROM clause, and its arguments, for the users
+// matching filter. Searches join the users_fts index, exposing as
+// search.rank how many terms match a whole word of the name rather than
+// just a prefix of one, as the memory repository ranks them.
+func filterSource(filter domain.UserFilter) (string, []interface{}) {
+	if filter.Query == "" {
+		return "users", nil
+	}
+
+	terms := domain.SearchTerms(filter.Query)
+	wholeWords := make([]string, len(terms))
+	args := make([]interface{}, 0, len(terms)+1)
+	for i, term := range terms {
+		wholeWords[i] = "(docid IN (SELECT docid FROM users_fts WHERE users_fts MATCH ?))"
+		args = append(args, quoteTerm(term))
+	}
+	args = append(args, matchExpression(terms))
+
+	source := `users JOIN (
+		SELECT docid, ` + strings.Join(wholeWords, " + ") + ` AS rank
+		FROM users_fts WHERE users_fts MATCH ?
+	) AS search ON search.docid = users.id`
+	return source, args
+}
+
+// matchExpression turns search terms into an FTS4 query that requires a
+// prefix match for every term
+func matchExpression(terms []string) string {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = quoteTerm(term + "*")
+	}
+	return strings.Join(prefixes, " ")
+}
+
+// quoteTerm quotes a search term for an FTS4 query. Terms only hold letters
+// and digits, so quoting them is enough to keep FTS4 operators out.
+func quoteTerm(term string) string {
+	return `"` + term + `"`
+}
+
+// filterConditions returns the WHERE conditions, and their arguments, that
+// select the users matching filter regardless of pagination
+func filterConditions(filter domain.UserFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	return conditions, args
+}
+
 // Close closes the database connection
 func (r *userRepository) Close() error {
 	return r.db.Close()
@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/repository"
+	"github.com/ucups/go-user-service/internal/repository/repositorytest"
+)
+
+// newTestRepository opens a repository on a fresh database file
+func newTestRepository(t *testing.T) *userRepository {
+	t.Helper()
+	repo, err := NewUserRepository(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestUserRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.UserRepository {
+		return newTestRepository(t)
+	})
+}
+
+func TestSearchFoldsAccentsAndRanksWholeWordsFirst(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	var ids []int64
+	for i, name := range []string{"José Smith", "Josefina Jones", "Ana Joseph"} {
+		user := &domain.User{Name: name, CreatedAt: int64(1000 * (i + 1)), UpdatedAt: int64(1000 * (i + 1))}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create(%q) failed: %v", name, err)
+		}
+		ids = append(ids, user.ID)
+	}
+
+	users, err := repo.GetAll(ctx, domain.UserFilter{PageNum: 1, PageSize: 10, Query: "jose"})
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+
+	// The whole word match comes first, then the prefix matches newest first
+	want := []int64{ids[0], ids[2], ids[1]}
+	if len(users) != len(want) {
+		t.Fatalf("search returned %d users, want %d", len(users), len(want))
+	}
+	for i, user := range users {
+		if user.ID != want[i] {
+			t.Errorf("result %d = %q, want ID %d", i, user.Name, want[i])
+		}
+	}
+}
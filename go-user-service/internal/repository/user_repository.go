@@ -1,17 +1,43 @@
 package repository
 
-import "github.com/ucups/go-user-service/internal/domain"
+import (
+	"context"
 
-// UserRepository defines the interface for user data persistence
+	"github.com/ucups/go-user-service/internal/domain"
+)
+
+// UserRepository defines the interface for user data persistence. Every
+// method except Close stops its work and returns ctx.Err() once ctx is done.
 type UserRepository interface {
-	// Create adds a new user to the repository
-	Create(user *domain.User) error
+	// Create adds a new user to the repository. Email addresses are
+	// unique across all users, including soft deleted ones; a duplicate
+	// fails with domain.ErrEmailTaken.
+	Create(ctx context.Context, user *domain.User) error
+
+	// GetByID retrieves a user by ID. Soft deleted users are reported as
+	// not found unless includeDeleted is set.
+	GetByID(ctx context.Context, id int64, includeDeleted bool) (*domain.User, error)
+
+	// GetByIDs retrieves the users matching the given IDs. IDs with no
+	// matching user, and soft deleted users unless includeDeleted is set,
+	// are left out of the result.
+	GetByIDs(ctx context.Context, ids []int64, includeDeleted bool) ([]*domain.User, error)
+
+	// Update persists changes to an existing user, including soft deletion
+	// and restoration. The write only succeeds if the stored user is still
+	// at version expectedUpdatedAt, otherwise domain.ErrStaleUser is
+	// returned.
+	Update(ctx context.Context, user *domain.User, expectedUpdatedAt int64) error
 
-	// GetByID retrieves a user by ID
-	GetByID(id int64) (*domain.User, error)
+	// GetAll retrieves up to filter.MaxUsers() users ordered by created_at
+	// and then id, both descending, skipping filter.Offset(). With
+	// filter.After set, the users are those that sort after that cursor and
+	// filter.PageNum is ignored.
+	GetAll(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error)
 
-	// GetAll retrieves all users with pagination
-	GetAll(filter domain.UserFilter) ([]*domain.User, error)
+	// Count returns how many users match filter. Pagination fields and the
+	// cursor are ignored.
+	Count(ctx context.Context, filter domain.UserFilter) (int64, error)
 
 	// Close closes the repository connection
 	Close() error
@@ -1,12 +1,18 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/ucups/go-user-service/internal/domain"
 	"github.com/ucups/go-user-service/internal/repository"
+	"go.opentelemetry.io/otel"
 )
 
+// tracer creates a span for every use case call
+var tracer = otel.Tracer("github.com/ucups/go-user-service/internal/usecase")
+
 // UserUseCase handles user business logic
 type UserUseCase struct {
 	repo repository.UserRepository
@@ -19,50 +25,233 @@ func NewUserUseCase(repo repository.UserRepository) *UserUseCase {
 	}
 }
 
-// CreateUser creates a new user
-func (uc *UserUseCase) CreateUser(name string) (*domain.User, error) {
+// CreateUser creates a new user. It fails with domain.ErrEmailTaken when
+// another user already has the email address.
+func (uc *UserUseCase) CreateUser(ctx context.Context, name, email, phone string) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.CreateUser")
+	defer span.End()
+
 	// Create and validate user
-	user, err := domain.NewUser(name)
+	user, err := domain.NewUser(name, email, phone)
 	if err != nil {
 		return nil, err
 	}
 
 	// Persist user
-	if err := uc.repo.Create(user); err != nil {
+	if err := uc.repo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return user, nil
 }
 
-// GetUserByID retrieves a user by ID
-func (uc *UserUseCase) GetUserByID(id int64) (*domain.User, error) {
-	user, err := uc.repo.GetByID(id)
+// GetUserByID retrieves a user by ID. Soft deleted users are only returned
+// when includeDeleted is set.
+func (uc *UserUseCase) GetUserByID(ctx context.Context, id int64, includeDeleted bool) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.GetUserByID")
+	defer span.End()
+
+	user, err := uc.repo.GetByID(ctx, id, includeDeleted)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return user, nil
 }
 
-// GetAllUsers retrieves all users with pagination
-func (uc *UserUseCase) GetAllUsers(pageNum, pageSize int) ([]*domain.User, error) {
-	// Set defaults
-	if pageNum < 1 {
-		pageNum = 1
+// UpdateUser applies changes to an existing user. A nil name leaves the name
+// unchanged. When expectedUpdatedAt is set, the update is rejected with
+// domain.ErrStaleUser unless the stored user is still at that version. An
+// update that changes nothing returns the user as stored, keeping its
+// version.
+func (uc *UserUseCase) UpdateUser(ctx context.Context, id int64, name *string, expectedUpdatedAt *int64) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.UpdateUser")
+	defer span.End()
+
+	user, err := uc.repo.GetByID(ctx, id, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if expectedUpdatedAt != nil && user.UpdatedAt != *expectedUpdatedAt {
+		return nil, domain.ErrStaleUser
+	}
+
+	if name == nil || *name == user.Name {
+		return user, nil
+	}
+
+	previousUpdatedAt := user.UpdatedAt
+	if err := user.Rename(*name); err != nil {
+		return nil, err
+	}
+
+	// The repository re-checks the version so concurrent writers cannot
+	// both succeed
+	if err := uc.repo.Update(ctx, user, previousUpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return user, nil
+}
+
+// DeleteUser soft deletes a user. Deleting a user that is already deleted
+// reports domain.ErrUserNotFound.
+func (uc *UserUseCase) DeleteUser(ctx context.Context, id int64) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.DeleteUser")
+	defer span.End()
+
+	user, err := uc.repo.GetByID(ctx, id, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	previousUpdatedAt := user.UpdatedAt
+	user.MarkDeleted()
+	if err := uc.repo.Update(ctx, user, previousUpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return user, nil
+}
+
+// RestoreUser undoes the soft deletion of a user. Restoring a user that is
+// not deleted is a no-op.
+func (uc *UserUseCase) RestoreUser(ctx context.Context, id int64) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.RestoreUser")
+	defer span.End()
+
+	user, err := uc.repo.GetByID(ctx, id, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !user.IsDeleted() {
+		return user, nil
 	}
-	if pageSize < 1 {
-		pageSize = 10
+
+	previousUpdatedAt := user.UpdatedAt
+	user.Restore()
+	if err := uc.repo.Update(ctx, user, previousUpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	return user, nil
+}
+
+// MaxBatchSize is the maximum number of IDs accepted by GetUsersByIDs
+const MaxBatchSize = 100
+
+// GetUsersByIDs retrieves the users matching ids. Duplicate IDs are ignored.
+// It returns the users that were found and the IDs that were not. Soft
+// deleted users count as not found unless includeDeleted is set.
+func (uc *UserUseCase) GetUsersByIDs(ctx context.Context, ids []int64, includeDeleted bool) ([]*domain.User, []int64, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.GetUsersByIDs")
+	defer span.End()
+
+	unique := make([]int64, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	if len(unique) > MaxBatchSize {
+		return nil, nil, domain.NewValidationError("ids", domain.CodeTooMany, fmt.Sprintf("at most %d ids can be requested at once", MaxBatchSize))
+	}
+
+	users, err := uc.repo.GetByIDs(ctx, unique, includeDeleted)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	found := make(map[int64]bool, len(users))
+	for _, user := range users {
+		found[user.ID] = true
+	}
+
+	missing := make([]int64, 0)
+	for _, id := range unique {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	return users, missing, nil
+}
+
+// SearchUsers retrieves a page of the users whose name matches
+// filter.Query, most relevant first. It is GetAllUsers with a required query.
+func (uc *UserUseCase) SearchUsers(ctx context.Context, filter domain.UserFilter, withTotal bool) (*domain.UserPage, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.SearchUsers")
+	defer span.End()
+
+	if strings.TrimSpace(filter.Query) == "" {
+		return nil, domain.NewValidationError("q", domain.CodeRequired, "q is required")
 	}
+	return uc.GetAllUsers(ctx, filter, withTotal)
+}
 
-	filter := domain.UserFilter{
-		PageNum:  pageNum,
-		PageSize: pageSize,
+// GetAllUsers retrieves a page of users, newest first. filter.After
+// continues from a cursor returned with a previous page; otherwise the page
+// is picked by filter.PageNum. withTotal also counts every matching user,
+// which costs a query over the whole table.
+func (uc *UserUseCase) GetAllUsers(ctx context.Context, filter domain.UserFilter, withTotal bool) (*domain.UserPage, error) {
+	ctx, span := tracer.Start(ctx, "UserUseCase.GetAllUsers")
+	defer span.End()
+
+	if filter.Query != "" {
+		if len(domain.SearchTerms(filter.Query)) == 0 {
+			return nil, domain.NewValidationError("q", domain.CodeInvalid, "q must contain a letter or digit")
+		}
+		if filter.After != nil {
+			return nil, domain.NewValidationError("cursor", domain.CodeConflict, "search results are paged by page_num, not cursor")
+		}
+	}
+
+	// Set defaults
+	if filter.PageNum < 1 {
+		filter.PageNum = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 10
 	}
 
-	users, err := uc.repo.GetAll(filter)
+	// Read one user past the page to learn whether another page follows
+	read := filter
+	read.Limit = filter.PageSize + 1
+	users, err := uc.repo.GetAll(ctx, read)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
+	hasMore := len(users) > filter.PageSize
+	if hasMore {
+		users = users[:filter.PageSize]
+	}
+
+	page := &domain.UserPage{
+		Users:    users,
+		PageNum:  filter.PageNum,
+		PageSize: filter.PageSize,
+		HasMore:  hasMore,
+	}
+	if filter.After != nil {
+		page.PageNum = 0
+	}
+
+	if withTotal {
+		total, err := uc.repo.Count(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count users: %w", err)
+		}
+		page.Total = &total
+	}
+
+	// Relevance order has no keyset, so searches have no cursor
+	if hasMore && filter.Query == "" {
+		page.NextCursor = domain.CursorAfter(users[len(users)-1]).Encode()
+	}
 
-	return users, nil
+	return page, nil
 }
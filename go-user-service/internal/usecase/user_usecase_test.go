@@ -0,0 +1,272 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ucups/go-user-service/internal/domain"
+	"github.com/ucups/go-user-service/internal/repository/memory"
+)
+
+// newTestUseCase returns a use case backed by an empty in-memory repository
+func newTestUseCase() *UserUseCase {
+	return NewUserUseCase(memory.NewUserRepository())
+}
+
+// mustCreateUser creates a user with the given name and no contact details
+func mustCreateUser(t *testing.T, uc *UserUseCase, name string) *domain.User {
+	t.Helper()
+	user, err := uc.CreateUser(context.Background(), name, "", "")
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %v", name, err)
+	}
+	return user
+}
+
+// validationFields returns the fields err reports as invalid, failing the
+// test if err is not a validation error
+func validationFields(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var validationErr *domain.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	fields := make(map[string]string)
+	for _, field := range validationErr.Fields {
+		fields[field.Field] = field.Code
+	}
+	return fields
+}
+
+func TestCreateUserValidates(t *testing.T) {
+	uc := newTestUseCase()
+
+	_, err := uc.CreateUser(context.Background(), "", "not-an-email", "")
+	fields := validationFields(t, err)
+	if fields["name"] != domain.CodeRequired {
+		t.Errorf("name code = %q, want %q", fields["name"], domain.CodeRequired)
+	}
+	if fields["email"] != domain.CodeInvalid {
+		t.Errorf("email code = %q, want %q", fields["email"], domain.CodeInvalid)
+	}
+}
+
+func TestCreateUserRejectsTakenEmail(t *testing.T) {
+	uc := newTestUseCase()
+	ctx := context.Background()
+
+	if _, err := uc.CreateUser(ctx, "Alice", "alice@example.com", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	_, err := uc.CreateUser(ctx, "Alicia", "alice@example.com", "")
+	if !errors.Is(err, domain.ErrEmailTaken) {
+		t.Errorf("err = %v, want ErrEmailTaken", err)
+	}
+}
+
+func TestGetUserByIDNotFound(t *testing.T) {
+	uc := newTestUseCase()
+
+	_, err := uc.GetUserByID(context.Background(), 42, false)
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUpdateUserChecksVersion(t *testing.T) {
+	uc := newTestUseCase()
+	ctx := context.Background()
+	user := mustCreateUser(t, uc, "Alice")
+
+	name := "Alice Smith"
+	updated, err := uc.UpdateUser(ctx, user.ID, &name, &user.UpdatedAt)
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.Name != name || updated.UpdatedAt <= user.UpdatedAt {
+		t.Errorf("updated = %+v, want renamed with a newer version than %d", updated, user.UpdatedAt)
+	}
+
+	// The version the first update was based on is now stale
+	other := "Alice Jones"
+	if _, err := uc.UpdateUser(ctx, user.ID, &other, &user.UpdatedAt); !errors.Is(err, domain.ErrStaleUser) {
+		t.Errorf("stale update err = %v, want ErrStaleUser", err)
+	}
+
+	got, err := uc.GetUserByID(ctx, user.ID, false)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got.Name != name {
+		t.Errorf("name = %q after a rejected update, want %q", got.Name, name)
+	}
+}
+
+func TestUpdateUserWithoutChangesKeepsVersion(t *testing.T) {
+	uc := newTestUseCase()
+	ctx := context.Background()
+	user := mustCreateUser(t, uc, "Alice")
+
+	sameName := user.Name
+	for _, name := range []*string{nil, &sameName} {
+		updated, err := uc.UpdateUser(ctx, user.ID, name, &user.UpdatedAt)
+		if err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+		if updated.UpdatedAt != user.UpdatedAt {
+			t.Errorf("UpdatedAt = %d, want %d unchanged", updated.UpdatedAt, user.UpdatedAt)
+		}
+	}
+
+	stored, err := uc.GetUserByID(ctx, user.ID, false)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if stored.UpdatedAt != user.UpdatedAt {
+		t.Errorf("stored UpdatedAt = %d, want %d unchanged", stored.UpdatedAt, user.UpdatedAt)
+	}
+
+	// The version is still checked
+	stale := user.UpdatedAt - 1
+	if _, err := uc.UpdateUser(ctx, user.ID, nil, &stale); !errors.Is(err, domain.ErrStaleUser) {
+		t.Errorf("err = %v, want ErrStaleUser", err)
+	}
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	uc := newTestUseCase()
+	ctx := context.Background()
+	user := mustCreateUser(t, uc, "Alice")
+
+	deleted, err := uc.DeleteUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if !deleted.IsDeleted() {
+		t.Error("deleted user is not marked deleted")
+	}
+	if _, err := uc.GetUserByID(ctx, user.ID, false); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("GetUserByID of a deleted user err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := uc.GetUserByID(ctx, user.ID, true); err != nil {
+		t.Errorf("GetUserByID with includeDeleted: %v", err)
+	}
+	if _, err := uc.DeleteUser(ctx, user.ID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("second DeleteUser err = %v, want ErrUserNotFound", err)
+	}
+
+	restored, err := uc.RestoreUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if restored.IsDeleted() {
+		t.Error("restored user is still marked deleted")
+	}
+	if _, err := uc.GetUserByID(ctx, user.ID, false); err != nil {
+		t.Errorf("GetUserByID of a restored user: %v", err)
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	uc := newTestUseCase()
+	ctx := context.Background()
+	alice := mustCreateUser(t, uc, "Alice")
+	bob := mustCreateUser(t, uc, "Bob")
+	if _, err := uc.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	users, missing, err := uc.GetUsersByIDs(ctx, []int64{alice.ID, alice.ID, bob.ID, 99}, false)
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != alice.ID {
+		t.Errorf("users = %+v, want only Alice", users)
+	}
+	if len(missing) != 2 || missing[0] != bob.ID || missing[1] != 99 {
+		t.Errorf("missing = %v, want [%d 99]", missing, bob.ID)
+	}
+
+	users, missing, err = uc.GetUsersByIDs(ctx, []int64{bob.ID}, true)
+	if err != nil {
+		t.Fatalf("GetUsersByIDs with includeDeleted: %v", err)
+	}
+	if len(users) != 1 || len(missing) != 0 {
+		t.Errorf("users = %+v, missing = %v, want deleted Bob found", users, missing)
+	}
+}
+
+func TestGetUsersByIDsLimitsBatch(t *testing.T) {
+	uc := newTestUseCase()
+
+	ids := make([]int64, MaxBatchSize+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	_, _, err := uc.GetUsersByIDs(context.Background(), ids, false)
+	if fields := validationFields(t, err); fields["ids"] != domain.CodeTooMany {
+		t.Errorf("ids code = %q, want %q", fields["ids"], domain.CodeTooMany)
+	}
+}
+
+func TestGetAllUsersPagesNewestFirst(t *testing.T) {
+	uc := newTestUseCase()
+	ctx := context.Background()
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		mustCreateUser(t, uc, name)
+	}
+
+	first, err := uc.GetAllUsers(ctx, domain.UserFilter{PageNum: 1, PageSize: 2}, true)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(first.Users) != 2 || first.Users[0].Name != "Carol" || first.Users[1].Name != "Bob" {
+		t.Errorf("first page = %+v, want Carol and Bob", first.Users)
+	}
+	if first.Total == nil || *first.Total != 3 || !first.HasMore || first.NextCursor == "" {
+		t.Errorf("first page total = %v, has_more = %v, cursor = %q, want 3, true and a cursor", first.Total, first.HasMore, first.NextCursor)
+	}
+
+	after, err := domain.ParseUserCursor(first.NextCursor)
+	if err != nil {
+		t.Fatalf("ParseUserCursor: %v", err)
+	}
+	second, err := uc.GetAllUsers(ctx, domain.UserFilter{PageSize: 2, After: after}, false)
+	if err != nil {
+		t.Fatalf("GetAllUsers after cursor: %v", err)
+	}
+	if len(second.Users) != 1 || second.Users[0].Name != "Alice" {
+		t.Errorf("second page = %+v, want Alice", second.Users)
+	}
+	if second.HasMore || second.NextCursor != "" || second.Total != nil {
+		t.Errorf("second page has_more = %v, cursor = %q, total = %v, want the last page without a total", second.HasMore, second.NextCursor, second.Total)
+	}
+}
+
+func TestSearchUsersRequiresQuery(t *testing.T) {
+	uc := newTestUseCase()
+
+	_, err := uc.SearchUsers(context.Background(), domain.UserFilter{Query: "  "}, false)
+	if fields := validationFields(t, err); fields["q"] != domain.CodeRequired {
+		t.Errorf("q code = %q, want %q", fields["q"], domain.CodeRequired)
+	}
+}
+
+func TestSearchUsersMatchesNamePrefixes(t *testing.T) {
+	uc := newTestUseCase()
+	for _, name := range []string{"Alice Smith", "Bob Smithers", "Carol Jones"} {
+		mustCreateUser(t, uc, name)
+	}
+
+	page, err := uc.SearchUsers(context.Background(), domain.UserFilter{Query: "smi"}, true)
+	if err != nil {
+		t.Fatalf("SearchUsers: %v", err)
+	}
+	if page.Total == nil || *page.Total != 2 || len(page.Users) != 2 {
+		t.Errorf("page = %+v, want Alice Smith and Bob Smithers", page)
+	}
+	if page.NextCursor != "" {
+		t.Errorf("search cursor = %q, want none", page.NextCursor)
+	}
+}
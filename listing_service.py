@@ -5,6 +5,9 @@ import sqlite3
 import logging
 import json
 import time
+import base64
+import re
+import uuid
 
 class App(tornado.web.Application):
 
@@ -32,7 +35,46 @@ class App(tornado.web.Application):
         )
         self.db.commit()
 
+def encode_cursor(created_at, listing_id):
+    raw = "{}:{}".format(created_at, listing_id).encode()
+    return base64.urlsafe_b64encode(raw).decode().rstrip("=")
+
+def decode_cursor(token):
+    try:
+        raw = base64.urlsafe_b64decode(token + "=" * (-len(token) % 4)).decode()
+        created_at, listing_id = raw.split(":")
+        return int(created_at), int(listing_id)
+    except Exception:
+        return None
+
+REQUEST_ID_HEADER = "X-Request-ID"
+VALID_REQUEST_ID = re.compile(r"^[A-Za-z0-9._-]{1,128}$")
+
+def log_request(handler):
+    # One JSON line per request, matching the Go services' access logs
+    request = handler.request
+    logging.getLogger("tornado.access").info(json.dumps({
+        "time": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()),
+        "level": "INFO" if handler.get_status() < 500 else "ERROR",
+        "msg": "request",
+        "request_id": getattr(handler, "request_id", ""),
+        "route": request.path,
+        "method": request.method,
+        "path": request.path,
+        "status": handler.get_status(),
+        "latency_ms": round(request.request_time() * 1000, 3),
+    }))
+
 class BaseHandler(tornado.web.RequestHandler):
+    def prepare(self):
+        # Adopt the caller's request ID so that log lines can be tied to the
+        # public API request that caused them
+        request_id = self.request.headers.get(REQUEST_ID_HEADER, "")
+        if not VALID_REQUEST_ID.match(request_id):
+            request_id = uuid.uuid4().hex
+        self.request_id = request_id
+        self.set_header(REQUEST_ID_HEADER, request_id)
+
     def write_json(self, obj, status_code=200):
         self.set_header("Content-Type", "application/json")
         self.set_status(status_code)
@@ -68,21 +110,48 @@ class ListingsHandler(BaseHandler):
                 self.write_json({"result": False, "errors": "invalid user_id"}, status_code=400)
                 return
 
-        # Building select statement
-        select_stmt = "SELECT * FROM listings"
+        # Parsing cursor param, which continues after the last listing of a previous page
+        after = self.get_argument("cursor", None)
+        if after is not None:
+            after = decode_cursor(after)
+            if after is None:
+                self.write_json({"result": False, "errors": "invalid cursor"}, status_code=400)
+                return
+
+        # Parsing include_total param, counting can be skipped for speed
+        include_total = self.get_argument("include_total", "true").lower()
+        if include_total not in ("true", "false", "1", "0"):
+            self.write_json({"result": False, "errors": "invalid include_total"}, status_code=400)
+            return
+        include_total = include_total in ("true", "1")
+
+        # Building filter clause, shared by the select and the count
+        conditions = []
+        filter_args = []
         # Adding user_id filter clause if param is specified
         if user_id is not None:
-            select_stmt += " WHERE user_id=?"
-        # Order by and pagination
-        limit = page_size
-        offset = (page_num - 1) * page_size
-        select_stmt += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+            conditions.append("user_id=?")
+            filter_args.append(user_id)
+
+        # Building select statement
+        select_stmt = "SELECT * FROM listings"
+        select_conditions = list(conditions)
+        args = list(filter_args)
+        # Adding keyset clause if a cursor is specified
+        if after is not None:
+            select_conditions.append("(created_at < ? OR (created_at = ? AND id < ?))")
+            args.extend([after[0], after[0], after[1]])
+        if select_conditions:
+            select_stmt += " WHERE " + " AND ".join(select_conditions)
+        # Order by and pagination. A cursor replaces the offset. One extra
+        # row is fetched to tell whether another page follows.
+        select_stmt += " ORDER BY created_at DESC, id DESC LIMIT ?"
+        args.append(page_size + 1)
+        if after is None:
+            select_stmt += " OFFSET ?"
+            args.append((page_num - 1) * page_size)
 
         # Fetching listings from db
-        if user_id is not None:
-            args = (user_id, limit, offset)
-        else:
-            args = (limit, offset)
         cursor = self.application.db.cursor()
         results = cursor.execute(select_stmt, args)
 
@@ -94,7 +163,29 @@ class ListingsHandler(BaseHandler):
             }
             listings.append(listing)
 
-        self.write_json({"result": True, "listings": listings})
+        has_more = len(listings) > page_size
+        listings = listings[:max(page_size, 0)]
+
+        next_cursor = None
+        if has_more and listings:
+            last = listings[-1]
+            next_cursor = encode_cursor(last["created_at"], last["id"])
+
+        # Counting every listing matching the filter
+        total = None
+        if include_total:
+            count_stmt = "SELECT COUNT(*) FROM listings"
+            if conditions:
+                count_stmt += " WHERE " + " AND ".join(conditions)
+            total = cursor.execute(count_stmt, filter_args).fetchone()[0]
+
+        self.write_json({
+            "result": True,
+            "listings": listings,
+            "next_cursor": next_cursor,
+            "has_more": has_more,
+            "total": total,
+        })
 
     @tornado.gen.coroutine
     def post(self):
@@ -173,7 +264,7 @@ class ListingsHandler(BaseHandler):
             return price
 
 # /listings/ping
-class PingHandler(tornado.web.RequestHandler):
+class PingHandler(BaseHandler):
     @tornado.gen.coroutine
     def get(self):
         self.write("pong!")
@@ -182,7 +273,7 @@ def make_app(options):
     return App([
         (r"/listings/ping", PingHandler),
         (r"/listings", ListingsHandler),
-    ], debug=options.debug)
+    ], debug=options.debug, log_function=log_request)
 
 if __name__ == "__main__":
     # Define settings/options for the web app